@@ -0,0 +1,72 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// Client reads and writes blobs of a single container. It can be used as a kafka.BlobStore.
+type Client struct {
+	client    *azblob.Client
+	container string
+}
+
+// NewClient returns a new Blob Storage client for a container using workload identity.
+// serviceURL example: "https://<account>.blob.core.windows.net/"
+func NewClient(serviceURL string, container string) (*Client, error) {
+	wi := &azidentity.WorkloadIdentityCredentialOptions{
+		TenantID:      strings.TrimSpace(os.Getenv("AZURE_TENANT_ID")),
+		ClientID:      strings.TrimSpace(os.Getenv("AZURE_CLIENT_ID")),
+		TokenFilePath: strings.TrimSpace(os.Getenv("AZURE_FEDERATED_TOKEN_FILE")),
+	}
+	cred, err := azidentity.NewWorkloadIdentityCredential(wi)
+	if err != nil {
+		return nil, fmt.Errorf("workload identity credential init failed: %w", err)
+	}
+
+	bc, err := azblob.NewClient(strings.TrimSpace(serviceURL), cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating azblob client: %w", err)
+	}
+
+	return &Client{client: bc, container: container}, nil
+}
+
+// NewClientFromConnectionString returns a new Blob Storage client for a container using a connection string.
+func NewClientFromConnectionString(connStr string, container string) (*Client, error) {
+	bc, err := azblob.NewClientFromConnectionString(connStr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating azblob client: %w", err)
+	}
+
+	return &Client{client: bc, container: container}, nil
+}
+
+func (c *Client) Put(ctx context.Context, name string, data []byte) error {
+	_, err := c.client.UploadBuffer(ctx, c.container, name, data, nil)
+
+	return err
+}
+
+func (c *Client) Get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := c.client.DownloadStream(ctx, c.container, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (c *Client) Delete(ctx context.Context, name string) error {
+	_, err := c.client.DeleteBlob(ctx, c.container, name, nil)
+
+	return err
+}
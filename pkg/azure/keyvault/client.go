@@ -169,6 +169,28 @@ func (c *Client) GetPublicKey(ctx context.Context, keyName string, version *stri
 	return resp.Key, nil
 }
 
+// ResolvePublicKey returns the public key for a key ID of the form "<keyName>/<version>", as returned by the
+// KeyID method of signers created by GetSigner. Full Key Vault Key IDs are accepted as well.
+func (c *Client) ResolvePublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	var keyName, version string
+	if strings.Contains(keyID, "/keys/") {
+		_, keyName, version = ParseKeyID(keyID)
+	} else {
+		keyName, version, _ = strings.Cut(keyID, "/")
+	}
+
+	if keyName == "" {
+		return nil, fmt.Errorf("invalid key ID %q", keyID)
+	}
+
+	jwk, err := c.GetPublicKey(ctx, keyName, &version)
+	if err != nil {
+		return nil, err
+	}
+
+	return JWKToPublicKey(jwk)
+}
+
 // safeKid logs the ID in a truncated form so you can still match it by eye.
 func safeKid(kid *azkeys.ID) string {
 	if kid == nil {
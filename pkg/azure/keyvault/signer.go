@@ -26,6 +26,9 @@ type kvSigner struct {
 // Public implements crypto.Signer
 func (s *kvSigner) Public() crypto.PublicKey { return s.pub }
 
+// KeyID returns "<keyName>/<version>" of the signing key. It can be resolved with Client.ResolvePublicKey.
+func (s *kvSigner) KeyID() string { return s.keyName + "/" + s.version }
+
 // Sign implements crypto.Signer. It expects the **digest** according to opts.HashFunc().
 func (s *kvSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
 	if s == nil || s.client == nil || s.pub == nil {
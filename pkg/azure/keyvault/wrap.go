@@ -0,0 +1,80 @@
+package keyvault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+)
+
+// ---------------- Key wrapping ----------------
+
+var wrapAlgorithm = azkeys.EncryptionAlgorithmRSAOAEP256
+
+// WrapKey encrypts a data encryption key with the given key/version using RSA-OAEP-256.
+// It returns the full Key ID of the concrete key version used, so the key can be unwrapped later
+// even after the key was rotated.
+func (c *Client) WrapKey(ctx context.Context, keyName string, version *string, dek []byte) (string, []byte, error) {
+	if strings.TrimSpace(keyName) == "" {
+		return "", nil, fmt.Errorf("keyName is required")
+	}
+
+	v := ""
+	if version != nil {
+		v = strings.TrimSpace(*version)
+	}
+
+	resp, err := c.client.WrapKey(ctx, keyName, v, azkeys.KeyOperationParameters{
+		Algorithm: &wrapAlgorithm,
+		Value:     dek,
+	}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if resp.KID == nil {
+		return "", nil, errors.New("wrap key: missing KID in response")
+	}
+
+	return string(*resp.KID), resp.Result, nil
+}
+
+// UnwrapKey decrypts a data encryption key wrapped by WrapKey. kid is the Key ID returned by WrapKey.
+func (c *Client) UnwrapKey(ctx context.Context, kid string, wrapped []byte) ([]byte, error) {
+	_, keyName, version := ParseKeyID(kid)
+	if keyName == "" {
+		return nil, fmt.Errorf("invalid key ID %q", kid)
+	}
+
+	resp, err := c.client.UnwrapKey(ctx, keyName, version, azkeys.KeyOperationParameters{
+		Algorithm: &wrapAlgorithm,
+		Value:     wrapped,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Result, nil
+}
+
+// KeyProvider wraps data encryption keys with the latest version of a single Key Vault key.
+// It implements kafka.KeyProvider.
+type KeyProvider struct {
+	client  *Client
+	keyName string
+}
+
+// KeyProvider returns a KeyProvider for the given key.
+func (c *Client) KeyProvider(keyName string) *KeyProvider {
+	return &KeyProvider{client: c, keyName: keyName}
+}
+
+func (p *KeyProvider) WrapKey(ctx context.Context, dek []byte) (string, []byte, error) {
+	return p.client.WrapKey(ctx, p.keyName, nil, dek)
+}
+
+func (p *KeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	return p.client.UnwrapKey(ctx, keyID, wrapped)
+}
@@ -20,6 +20,15 @@ type ElionaJWT struct {
 	jwt.RegisteredClaims
 }
 
+const claimsContextKey = "claims"
+
+// ClaimsFromContext returns the claims stored in the request context by the authorization middleware.
+func ClaimsFromContext(ctx context.Context) (*ElionaJWT, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*ElionaJWT)
+
+	return claims, ok && claims != nil
+}
+
 func parseJWT(key []byte, tokenString string) (*ElionaJWT, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &ElionaJWT{}, func(token *jwt.Token) (any, error) {
 		return key, nil
@@ -85,7 +94,7 @@ func NewAuthorizationMiddleware(jwtSigningKey []byte) func(http.Handler) http.Ha
 				return
 			}
 
-			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "claims", claims)))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
 		})
 	}
 }
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderClaimCheck holds the name of the blob containing the value of a claim-check record.
+	HeaderClaimCheck = "claim-check"
+)
+
+// BlobStore stores payloads of records exceeding the claim-check threshold.
+type BlobStore interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// WithClaimCheck moves values larger than threshold bytes into the store and produces a reference record instead.
+// The reference record has an empty value and the blob name in the claim-check header. Consumed reference records
+// are resolved before they are passed to the handler.
+//
+// Register WithClaimCheck after other codecs such as WithEncryption, so that the stored payload is encoded as well.
+func WithClaimCheck(store BlobStore, threshold int) Opt {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, claimCheckInterceptor(store, threshold))
+		c.middlewares = append(c.middlewares, claimCheckMiddleware(store, c))
+	}
+}
+
+func claimCheckInterceptor(store BlobStore, threshold int) ProduceInterceptor {
+	return func(ctx context.Context, r Record) error {
+		if len(r.Value) <= threshold {
+			return nil
+		}
+
+		name := r.Topic + "/" + uuid.NewString()
+		if err := store.Put(ctx, name, r.Value); err != nil {
+			return fmt.Errorf("claim check: store %q: %w", name, err)
+		}
+
+		r.Value = []byte{}
+		SetHeader(r, HeaderClaimCheck, []byte(name))
+
+		return nil
+	}
+}
+
+func claimCheckMiddleware(store BlobStore, c *Client) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Record) {
+			name, ok := HeaderValue(r, HeaderClaimCheck)
+			if !ok {
+				next(r)
+				return
+			}
+
+			value, err := store.Get(c.recordContext(r), string(name))
+			if err != nil {
+				c.fail(r, fmt.Errorf("claim check: resolve %q of %s/%d@%d: %w", name, r.Topic, r.Partition, r.Offset, err))
+				return
+			}
+
+			r.Value = value
+			DeleteHeader(r, HeaderClaimCheck)
+			next(r)
+		}
+	}
+}
+
+// FileBlobStore is a BlobStore keeping blobs as files below a directory.
+type FileBlobStore struct {
+	dir string
+}
+
+func NewFileBlobStore(dir string) *FileBlobStore {
+	return &FileBlobStore{dir: dir}
+}
+
+func (s *FileBlobStore) Put(_ context.Context, name string, data []byte) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o640)
+}
+
+func (s *FileBlobStore) Get(_ context.Context, name string) ([]byte, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+func (s *FileBlobStore) path(name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", errors.New("invalid blob name " + name)
+	}
+
+	return filepath.Join(s.dir, cleaned), nil
+}
@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestClaimCheckRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileBlobStore(t.TempDir())
+	c := &Client{onError: func(err error) { t.Error(err) }}
+
+	payload := bytes.Repeat([]byte("floorplan"), 100)
+	r := &kgo.Record{Topic: "floorplans", Value: payload, Context: ctx}
+
+	if err := claimCheckInterceptor(store, 64)(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.Value) != 0 {
+		t.Fatalf("got value of %d bytes, want reference record", len(r.Value))
+	}
+
+	if _, ok := HeaderValue(r, HeaderClaimCheck); !ok {
+		t.Fatal("missing claim check header")
+	}
+
+	var got Record
+	claimCheckMiddleware(store, c)(func(r Record) { got = r })(r)
+
+	if got == nil {
+		t.Fatal("handler not called")
+	}
+
+	if !bytes.Equal(got.Value, payload) {
+		t.Error("resolved value differs from produced value")
+	}
+
+	if _, ok := HeaderValue(got, HeaderClaimCheck); ok {
+		t.Error("claim check header not removed")
+	}
+}
+
+func TestClaimCheckBelowThreshold(t *testing.T) {
+	ctx := context.Background()
+	r := &kgo.Record{Topic: "floorplans", Value: []byte("small")}
+
+	if err := claimCheckInterceptor(NewFileBlobStore(t.TempDir()), 64)(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(r.Value) != "small" || len(r.Headers) != 0 {
+		t.Error("record below threshold was modified")
+	}
+}
+
+func TestFileBlobStoreRejectsTraversal(t *testing.T) {
+	store := NewFileBlobStore(t.TempDir())
+
+	if err := store.Put(context.Background(), "../escape", []byte("x")); err == nil {
+		t.Error("expected error for name outside of the store directory")
+	}
+}
+
+func TestClaimCheckResolveError(t *testing.T) {
+	store := NewFileBlobStore(t.TempDir())
+
+	var reported error
+	c := &Client{onError: func(err error) { reported = err }}
+	handler := claimCheckMiddleware(store, c)(func(Record) { t.Error("handler called for unresolved record") })
+
+	r := &kgo.Record{Topic: "floorplans", Context: context.Background()}
+	SetHeader(r, HeaderClaimCheck, []byte("floorplans/missing"))
+
+	handler(r)
+	if reported == nil {
+		t.Error("got no error reported to the error handler")
+	}
+
+	// Pull-style consumers receive the record with the error instead.
+	var failed Record
+	reported = nil
+	r.Context = context.WithValue(context.Background(), recordErrorKey{}, func(r Record, err error) {
+		failed = r
+		reported = err
+	})
+
+	handler(r)
+	if failed != r || reported == nil {
+		t.Errorf("got record %v and error %v, want the unresolved record with an error", failed, reported)
+	}
+}
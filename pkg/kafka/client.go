@@ -2,8 +2,10 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/eliona-smart-building-assistant/backend-frm/pkg/log"
@@ -11,30 +13,52 @@ import (
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
+const (
+	defaultPingTimeout = 1 * time.Second
+)
+
 type Record *kgo.Record
 
 func NewRecord() Record {
 	return &kgo.Record{}
 }
 
+// HandlerFunc handles a consumed record. The record context (Record.Context) carries the trace context
+// of the producer and values set by middlewares.
 type HandlerFunc func(Record)
 
 type Subscriptions map[string]HandlerFunc
 
 type Client struct {
-	client          *kgo.Client
-	onError         func(error)
-	onPublish       func(Record)
-	logger          log.Logger
-	manualCommit    bool
-	consumerRunning bool
-	opts            []kgo.Opt
-	subsMu          sync.Mutex
-	subscriptions   Subscriptions
-	shutdown        chan struct{}
-	commitQueue     chan *kgo.Record
-	wg              sync.WaitGroup
-	maxFetches      int
+	client           *kgo.Client
+	onError          func(error)
+	onPublish        func(Record)
+	logger           log.Logger
+	manualCommit     bool
+	consumerRunning  atomic.Bool
+	opts             []kgo.Opt
+	subsMu           sync.Mutex
+	subscriptions    Subscriptions
+	handlers         map[string]HandlerFunc
+	shutdown         chan struct{}
+	commitQueue      chan *kgo.Record
+	wg               sync.WaitGroup
+	maxFetches       int
+	lastPoll         atomic.Int64
+	lastCommit       atomic.Int64
+	consumeLimits    map[string]*rateLimiter
+	produceLimits    map[string]*rateLimiter
+	throttleCounters map[string]*throttleCounters
+	middlewares      []Middleware
+	interceptors     []ProduceInterceptor
+	tracer           Tracer
+	propagator       Propagator
+	metrics          Metrics
+	group            string
+	tenancy          *tenancy
+	unpolledMu       sync.Mutex
+	unpolled         []*kgo.Record
+	optErr           error
 }
 
 func defaultClient() *Client {
@@ -45,6 +69,9 @@ func defaultClient() *Client {
 		opts:       []kgo.Opt{kgo.ClientID(hostname)},
 		shutdown:   make(chan struct{}),
 		maxFetches: 1,
+		tracer:     noopTracer{},
+		propagator: TraceContext{},
+		metrics:    noopMetrics{},
 	}
 }
 
@@ -56,6 +83,16 @@ func New(opts ...Opt) (*Client, error) {
 		opt(client)
 	}
 
+	if client.optErr != nil {
+		return nil, fmt.Errorf("kafka: invalid options: %w", client.optErr)
+	}
+
+	// Consumed records are marked once they were handled, so auto-commit never commits records that were polled
+	// but not handled yet.
+	if client.group != "" && !client.manualCommit {
+		client.opts = append(client.opts, kgo.AutoCommitMarks())
+	}
+
 	client.client, err = kgo.NewClient(client.opts...)
 	if err != nil {
 		return nil, err
@@ -66,10 +103,9 @@ func New(opts ...Opt) (*Client, error) {
 		Str("client_id", client.client.OptValue(kgo.ClientID).(string)).
 		Logger()
 	client.logger = &logger
+	client.group, _ = client.client.OptValue(kgo.ConsumerGroup).(string)
 
-	pingCtx, pingCancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer pingCancel()
-	err = client.client.Ping(pingCtx)
+	err = client.ping(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +115,10 @@ func New(opts ...Opt) (*Client, error) {
 		go client.commitWorker()
 	}
 
-	for topic := range client.subscriptions {
+	// Subscribed handlers are wrapped once instead of for every consumed record.
+	client.handlers = make(map[string]HandlerFunc, len(client.subscriptions))
+	for topic, handler := range client.subscriptions {
+		client.handlers[topic] = client.wrap(handler)
 		client.client.AddConsumeTopics(topic)
 	}
 
@@ -88,13 +127,25 @@ func New(opts ...Opt) (*Client, error) {
 	return client, nil
 }
 
+func (c *Client) ping(ctx context.Context) error {
+	pingCtx, pingCancel := context.WithTimeout(ctx, defaultPingTimeout)
+	defer pingCancel()
+
+	return c.client.Ping(pingCtx)
+}
+
 func (c *Client) Close() {
 	close(c.shutdown)
 	c.wg.Wait()
 	c.client.CloseAllowingRebalance()
 }
 
+// CommitRecords queues processed records for commit. It is a no-op unless the client uses WithManualCommit.
 func (c *Client) CommitRecords(r ...Record) {
+	if !c.manualCommit {
+		return
+	}
+
 	for i := range r {
 		c.commitQueue <- r[i]
 	}
@@ -0,0 +1,356 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Headers and content types of the CloudEvents Kafka protocol binding.
+const (
+	HeaderContentType       = "content-type"
+	CloudEventsHeaderPrefix = "ce_"
+	CloudEventsContentType  = "application/cloudevents+json; charset=UTF-8"
+	CloudEventsSpecVersion  = "1.0"
+)
+
+const (
+	cloudEventsMediaType     = "application/cloudevents+json"
+	maxEventExtensionNameLen = 20
+)
+
+var (
+	ErrNotCloudEvent = errors.New("record is not a cloud event")
+	ErrInvalidEvent  = errors.New("invalid cloud event")
+)
+
+// EventMode is the content mode of a CloudEvents record.
+type EventMode int
+
+const (
+	// EventModeBinary stores the attributes in ce_* headers and the data as record value.
+	EventModeBinary EventMode = iota
+	// EventModeStructured stores the whole event as JSON envelope in the record value.
+	EventModeStructured
+)
+
+// Event is a CloudEvent. ID, Source, SpecVersion and Type are required.
+type Event struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+	Extensions      map[string]string
+	Data            []byte
+}
+
+var eventAttributes = map[string]bool{
+	"id": true, "source": true, "specversion": true, "type": true, "subject": true, "time": true,
+	"datacontenttype": true, "dataschema": true, "data": true, "data_base64": true,
+}
+
+// Validate checks that all required attributes are set and extension names are valid.
+func (e Event) Validate() error {
+	required := []struct{ name, value string }{
+		{"id", e.ID},
+		{"source", e.Source},
+		{"specversion", e.SpecVersion},
+		{"type", e.Type},
+	}
+
+	for _, attr := range required {
+		if attr.value == "" {
+			return fmt.Errorf("%w: missing %s", ErrInvalidEvent, attr.name)
+		}
+	}
+
+	if e.SpecVersion != CloudEventsSpecVersion {
+		return fmt.Errorf("%w: unsupported specversion %q", ErrInvalidEvent, e.SpecVersion)
+	}
+
+	for name := range e.Extensions {
+		if eventAttributes[name] || !validExtensionName(name) {
+			return fmt.Errorf("%w: invalid extension name %q", ErrInvalidEvent, name)
+		}
+	}
+
+	return nil
+}
+
+func validExtensionName(name string) bool {
+	if name == "" || len(name) > maxEventExtensionNameLen {
+		return false
+	}
+
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewEventRecord validates the event and returns a record for the topic in the given mode.
+// An empty SpecVersion defaults to 1.0.
+func NewEventRecord(topic string, e Event, mode EventMode) (Record, error) {
+	if e.SpecVersion == "" {
+		e.SpecVersion = CloudEventsSpecVersion
+	}
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := NewRecord()
+	r.Topic = topic
+
+	switch mode {
+	case EventModeBinary:
+		writeBinaryEvent(r, e)
+	case EventModeStructured:
+		value, err := marshalStructuredEvent(e)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Value = value
+		SetHeader(r, HeaderContentType, []byte(CloudEventsContentType))
+	default:
+		return nil, fmt.Errorf("unknown event mode %d", mode)
+	}
+
+	return r, nil
+}
+
+func writeBinaryEvent(r Record, e Event) {
+	set := func(name, value string) {
+		if value != "" {
+			SetHeader(r, CloudEventsHeaderPrefix+name, []byte(value))
+		}
+	}
+
+	set("id", e.ID)
+	set("source", e.Source)
+	set("specversion", e.SpecVersion)
+	set("type", e.Type)
+	set("subject", e.Subject)
+	set("dataschema", e.DataSchema)
+
+	if !e.Time.IsZero() {
+		set("time", e.Time.Format(time.RFC3339Nano))
+	}
+
+	for name, value := range e.Extensions {
+		set(name, value)
+	}
+
+	if e.DataContentType != "" {
+		SetHeader(r, HeaderContentType, []byte(e.DataContentType))
+	}
+
+	r.Value = e.Data
+}
+
+func marshalStructuredEvent(e Event) ([]byte, error) {
+	envelope := map[string]any{
+		"id":          e.ID,
+		"source":      e.Source,
+		"specversion": e.SpecVersion,
+		"type":        e.Type,
+	}
+
+	optional := map[string]string{
+		"subject":         e.Subject,
+		"datacontenttype": e.DataContentType,
+		"dataschema":      e.DataSchema,
+	}
+
+	for name, value := range e.Extensions {
+		optional[name] = value
+	}
+
+	for name, value := range optional {
+		if value != "" {
+			envelope[name] = value
+		}
+	}
+
+	if !e.Time.IsZero() {
+		envelope["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+
+	if e.Data != nil {
+		if isJSONContentType(e.DataContentType) && json.Valid(e.Data) {
+			envelope["data"] = json.RawMessage(e.Data)
+		} else {
+			// encoding/json encodes byte slices as base64.
+			envelope["data_base64"] = e.Data
+		}
+	}
+
+	return json.Marshal(envelope)
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	return mediaType == "" || mediaType == "application/json" || mediaType == "text/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// ParseEvent reads the event of a record in structured or binary mode and validates it.
+// Records that are neither return ErrNotCloudEvent.
+func ParseEvent(r Record) (Event, error) {
+	contentType, _ := HeaderValue(r, HeaderContentType)
+	if strings.HasPrefix(string(contentType), cloudEventsMediaType) {
+		return parseStructuredEvent(r.Value)
+	}
+
+	if _, ok := HeaderValue(r, CloudEventsHeaderPrefix+"specversion"); ok {
+		return parseBinaryEvent(r)
+	}
+
+	return Event{}, ErrNotCloudEvent
+}
+
+func parseBinaryEvent(r Record) (Event, error) {
+	e := Event{Data: r.Value}
+
+	if contentType, ok := HeaderValue(r, HeaderContentType); ok {
+		e.DataContentType = string(contentType)
+	}
+
+	for _, h := range r.Headers {
+		name, ok := strings.CutPrefix(h.Key, CloudEventsHeaderPrefix)
+		if !ok {
+			continue
+		}
+
+		if err := e.setAttribute(name, string(h.Value)); err != nil {
+			return Event{}, err
+		}
+	}
+
+	return e, e.Validate()
+}
+
+func parseStructuredEvent(value []byte) (Event, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return Event{}, fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+
+	var e Event
+	for name, raw := range envelope {
+		switch name {
+		case "data":
+			e.Data = raw
+			continue
+		case "data_base64":
+			if err := json.Unmarshal(raw, &e.Data); err != nil {
+				return Event{}, fmt.Errorf("%w: data_base64: %w", ErrInvalidEvent, err)
+			}
+			continue
+		}
+
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			// Extensions may be booleans or numbers, which are kept in their JSON representation.
+			s = string(raw)
+		}
+
+		if err := e.setAttribute(name, s); err != nil {
+			return Event{}, err
+		}
+	}
+
+	return e, e.Validate()
+}
+
+func (e *Event) setAttribute(name, value string) error {
+	switch name {
+	case "id":
+		e.ID = value
+	case "source":
+		e.Source = value
+	case "specversion":
+		e.SpecVersion = value
+	case "type":
+		e.Type = value
+	case "subject":
+		e.Subject = value
+	case "datacontenttype":
+		e.DataContentType = value
+	case "dataschema":
+		e.DataSchema = value
+	case "time":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("%w: time: %w", ErrInvalidEvent, err)
+		}
+		e.Time = t
+	default:
+		if e.Extensions == nil {
+			e.Extensions = make(map[string]string)
+		}
+		e.Extensions[name] = value
+	}
+
+	return nil
+}
+
+// EventRoute selects events by type and subject. An empty Subject matches all subjects.
+type EventRoute struct {
+	Type    string
+	Subject string
+}
+
+// EventHandlerFunc handles a consumed event. The record is the one the event was read from.
+type EventHandlerFunc func(e Event, r Record)
+
+// EventRoutes maps event types and subjects to handlers.
+type EventRoutes map[EventRoute]EventHandlerFunc
+
+func (routes EventRoutes) lookup(e Event) (EventHandlerFunc, bool) {
+	if h, ok := routes[EventRoute{Type: e.Type, Subject: e.Subject}]; ok {
+		return h, true
+	}
+
+	h, ok := routes[EventRoute{Type: e.Type}]
+
+	return h, ok
+}
+
+// EventHandler returns a handler dispatching events to the routes. A route for type and subject takes
+// precedence over a route for the type only. Records that are no valid cloud events are reported to the error
+// handler, events without a route are skipped.
+func (c *Client) EventHandler(routes EventRoutes) HandlerFunc {
+	return func(r Record) {
+		e, err := ParseEvent(r)
+		if err != nil {
+			c.onError(fmt.Errorf("cloudevents: %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+			return
+		}
+
+		h, ok := routes.lookup(e)
+		if !ok {
+			c.logger.Debug().Msgf("cloudevents: no route for type %q and subject %q", e.Type, e.Subject)
+			return
+		}
+
+		h(e, r)
+	}
+}
+
+// AddEventSubscription subscribes to the topic and dispatches its events to the routes, see EventHandler.
+func (c *Client) AddEventSubscription(topic string, routes EventRoutes) {
+	c.AddSubscription(topic, c.EventHandler(routes))
+}
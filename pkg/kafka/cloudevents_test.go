@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/log"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestEventRoundTrip(t *testing.T) {
+	want := Event{
+		ID:              "1",
+		Source:          "/bookings",
+		SpecVersion:     CloudEventsSpecVersion,
+		Type:            "booking.created",
+		Subject:         "room-7",
+		Time:            time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		DataContentType: "application/json",
+		Extensions:      map[string]string{"tenantid": "t1"},
+		Data:            []byte(`{"room":7}`),
+	}
+
+	for _, mode := range []EventMode{EventModeBinary, EventModeStructured} {
+		r, err := NewEventRecord("bookings", want, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ParseEvent(r)
+		if err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+
+		if got.ID != want.ID || got.Type != want.Type || got.Subject != want.Subject || !got.Time.Equal(want.Time) ||
+			got.DataContentType != want.DataContentType || got.Extensions["tenantid"] != "t1" ||
+			string(got.Data) != string(want.Data) {
+			t.Errorf("mode %d: got %+v, want %+v", mode, got, want)
+		}
+	}
+
+	binary := Event{ID: "2", Source: "/files", Type: "file.uploaded", DataContentType: "image/png", Data: []byte{0xff, 0x00}}
+	r, err := NewEventRecord("files", binary, EventModeStructured)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseEvent(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got.Data) != string(binary.Data) {
+		t.Errorf("got data %v, want %v", got.Data, binary.Data)
+	}
+}
+
+func TestEventValidation(t *testing.T) {
+	if _, err := NewEventRecord("bookings", Event{ID: "1", Source: "/bookings"}, EventModeBinary); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidEvent)
+	}
+
+	if _, err := ParseEvent(&kgo.Record{Value: []byte("plain")}); !errors.Is(err, ErrNotCloudEvent) {
+		t.Errorf("got error %v, want %v", err, ErrNotCloudEvent)
+	}
+
+	r := &kgo.Record{}
+	SetHeader(r, "ce_specversion", []byte("1.0"))
+	SetHeader(r, "ce_id", []byte("1"))
+	if _, err := ParseEvent(r); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidEvent)
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	var reported []error
+	c := &Client{logger: log.NoopLogger(), onError: func(err error) { reported = append(reported, err) }}
+
+	var handled []string
+	handler := c.EventHandler(EventRoutes{
+		{Type: "booking.created"}: func(e Event, _ Record) {
+			handled = append(handled, "created")
+		},
+		{Type: "booking.created", Subject: "room-7"}: func(e Event, _ Record) {
+			handled = append(handled, "created room-7")
+		},
+	})
+
+	for _, e := range []Event{
+		{ID: "1", Source: "/bookings", Type: "booking.created", Subject: "room-7"},
+		{ID: "2", Source: "/bookings", Type: "booking.created", Subject: "room-8"},
+		{ID: "3", Source: "/bookings", Type: "booking.deleted"},
+	} {
+		r, err := NewEventRecord("bookings", e, EventModeBinary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler(r)
+	}
+
+	handler(&kgo.Record{Topic: "bookings", Value: []byte("plain")})
+
+	if len(handled) != 2 || handled[0] != "created room-7" || handled[1] != "created" {
+		t.Errorf("got handled %v, want [created room-7 created]", handled)
+	}
+
+	if len(reported) != 1 || !errors.Is(reported[0], ErrNotCloudEvent) {
+		t.Errorf("got reported errors %v, want [%v]", reported, ErrNotCloudEvent)
+	}
+}
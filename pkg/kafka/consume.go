@@ -2,14 +2,17 @@ package kafka
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"iter"
 	"time"
 
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 const (
-	commitInterval = 100 * time.Millisecond
+	commitInterval    = 100 * time.Millisecond
+	minPollRetryDelay = 100 * time.Millisecond
+	maxPollRetryDelay = 10 * time.Second
 )
 
 // AddConsumeTopic add a specified topic to an internal consumption list.
@@ -37,6 +40,7 @@ func (c *Client) AddSubscription(topic string, handler HandlerFunc) {
 		c.subscriptions = make(map[string]HandlerFunc)
 	}
 	c.subscriptions[topic] = handler
+	c.handlers[topic] = c.wrap(handler)
 	c.client.AddConsumeTopics(topic)
 	c.subsMu.Unlock()
 }
@@ -44,13 +48,14 @@ func (c *Client) AddSubscription(topic string, handler HandlerFunc) {
 func (c *Client) RemoveSubscription(topic string) {
 	c.subsMu.Lock()
 	delete(c.subscriptions, topic)
+	delete(c.handlers, topic)
 	c.client.PurgeTopicsFromClient(topic)
 	c.subsMu.Unlock()
 }
 
 // StartConsumer starts background polling of records on topics defined in Subscriptions
 func (c *Client) StartConsumer(ctx context.Context) {
-	c.consumerRunning = true
+	c.consumerRunning.Store(true)
 	c.wg.Add(1)
 	go c.consumeWorker(ctx)
 }
@@ -58,7 +63,7 @@ func (c *Client) StartConsumer(ctx context.Context) {
 func (c *Client) consumeWorker(ctx context.Context) {
 	defer func() {
 		c.wg.Done()
-		c.consumerRunning = false
+		c.consumerRunning.Store(false)
 	}()
 
 	for {
@@ -66,23 +71,30 @@ func (c *Client) consumeWorker(ctx context.Context) {
 		case <-c.shutdown:
 			return
 		default:
-			fetches := c.client.PollRecords(ctx, c.maxFetches)
-			if fetches.IsClientClosed() {
-				return
-			}
+			// Records a pull-style consumer polled but did not handle come first.
+			records := c.takeUnpolled(c.maxFetches)
+			if len(records) == 0 {
+				fetches := c.client.PollRecords(ctx, c.maxFetches)
+				if fetches.IsClientClosed() {
+					return
+				}
 
-			if errs := fetches.Errors(); len(errs) > 0 {
-				for i := range errs {
-					c.onError(wrapKgoConsumerError(errs[i].Err))
+				if errs := fetches.Errors(); len(errs) > 0 {
+					for i := range errs {
+						c.onError(wrapKgoConsumerError(errs[i].Err))
+					}
+
+					continue
 				}
 
-				continue
+				c.markPoll()
+				records = fetches.Records()
 			}
 
 			c.subsMu.Lock()
-			fetches.EachRecord(func(r *kgo.Record) {
-				c.subscriptions[r.Topic](r)
-			})
+			for _, r := range records {
+				c.handle(ctx, r, c.handlers[r.Topic])
+			}
 			c.subsMu.Unlock()
 		}
 	}
@@ -100,21 +112,21 @@ func (c *Client) commitWorker() {
 		case r := <-c.commitQueue:
 			pendingCommits = append(pendingCommits, r)
 			if len(pendingCommits) >= c.maxFetches {
-				_ = c.client.CommitRecords(c.client.Context(), pendingCommits...)
+				c.commit(pendingCommits)
 				clear(pendingCommits)
 				pendingCommits = pendingCommits[:0]
 			}
 
 		case <-ticker.C:
 			if len(pendingCommits) > 0 {
-				_ = c.client.CommitRecords(c.client.Context(), pendingCommits...)
+				c.commit(pendingCommits)
 				clear(pendingCommits)
 				pendingCommits = pendingCommits[:0]
 			}
 
 		case <-c.shutdown:
 			if len(pendingCommits) > 0 {
-				_ = c.client.CommitRecords(c.client.Context(), pendingCommits...)
+				c.commit(pendingCommits)
 				clear(pendingCommits)
 				pendingCommits = pendingCommits[:0]
 			}
@@ -123,54 +135,140 @@ func (c *Client) commitWorker() {
 	}
 }
 
-func (c *Client) PollRecords(fn func(r Record)) error {
-	if c.consumerRunning {
-		return fmt.Errorf("background consumer running")
+func (c *Client) commit(records []*kgo.Record) {
+	if err := c.client.CommitRecords(c.client.Context(), records...); err != nil {
+		c.onError(err)
+		return
 	}
 
-	fetches := c.client.PollRecords(nil, c.maxFetches)
-	if fetches.IsClientClosed() {
-		return kgo.ErrClientClosed
-	}
+	c.markCommit()
+}
 
-	if errs := fetches.Errors(); len(errs) > 0 {
-		return fetches.Err0()
+// Records returns an iterator over consumed records for pull-style consumers. It polls until the context is
+// canceled or the client is closed. Poll errors are yielded with a nil record; the iteration continues with
+// backoff unless the loop body breaks. ErrConsumerRunning is yielded once and ends the iteration.
+// Records a middleware cannot pass on, such as claim-check records whose blob cannot be resolved, are yielded
+// with the error.
+//
+// Records are passed through throttling and middlewares, which wrap the loop body. If the loop body breaks,
+// the remaining polled records are returned by the next poll. Without WithManualCommit, only records that
+// were yielded are committed; with it, acknowledge processed records with CommitRecords.
+func (c *Client) Records(ctx context.Context) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		delay := minPollRetryDelay
+
+		stopped := false
+		handler := c.wrap(func(r Record) {
+			stopped = !yield(r, nil)
+		})
+		recordCtx := context.WithValue(ctx, recordErrorKey{}, func(r Record, err error) {
+			stopped = !yield(r, err)
+		})
+
+		for {
+			records, err := c.poll(ctx)
+			if ctx.Err() != nil || errors.Is(err, kgo.ErrClientClosed) {
+				return
+			}
+
+			if err != nil {
+				if !yield(nil, err) || errors.Is(err, ErrConsumerRunning) {
+					return
+				}
+
+				c.sleep(ctx, delay)
+				delay = min(2*delay, maxPollRetryDelay)
+
+				continue
+			}
+
+			delay = minPollRetryDelay
+
+			for i, r := range records {
+				c.handle(recordCtx, r, handler)
+				if stopped {
+					c.unpoll(records[i+1:])
+					return
+				}
+			}
+		}
 	}
+}
+
+// handle passes the record through throttling to the wrapped handler and marks it for auto-commit afterwards.
+func (c *Client) handle(ctx context.Context, r *kgo.Record, wrapped HandlerFunc) {
+	c.throttleConsume(ctx, r.Topic)
+	r.Context = ctx
+	wrapped(r)
+	c.markConsumed(r)
+}
 
-	fetches.EachRecord(func(record *kgo.Record) {
-		fn(record)
+// collect passes the records through throttling and middlewares and returns those that passed all middlewares.
+func (c *Client) collect(ctx context.Context, records []*kgo.Record) []*kgo.Record {
+	collected := make([]*kgo.Record, 0, len(records))
+	handler := c.wrap(func(r Record) {
+		collected = append(collected, r)
 	})
 
-	return nil
+	for _, r := range records {
+		c.handle(ctx, r, handler)
+	}
+
+	return collected
 }
 
-func (c *Client) PollRecordsContext(ctx context.Context, fn func(r Record)) error {
-	if c.consumerRunning {
-		return fmt.Errorf("background consumer running")
+// markConsumed marks the record for auto-commit. Clients with manual commits acknowledge records with
+// CommitRecords instead.
+func (c *Client) markConsumed(r *kgo.Record) {
+	if !c.manualCommit {
+		c.client.MarkCommitRecords(r)
 	}
+}
 
-	fetches := c.client.PollRecords(ctx, c.maxFetches)
-	if fetches.IsClientClosed() {
-		return kgo.ErrClientClosed
+// unpoll keeps records that were polled but not handled, so the next poll returns them first.
+func (c *Client) unpoll(records []*kgo.Record) {
+	if len(records) == 0 {
+		return
 	}
 
-	if errs := fetches.Errors(); len(errs) > 0 {
-		return fetches.Err0()
+	c.unpolledMu.Lock()
+	c.unpolled = append(records, c.unpolled...)
+	c.unpolledMu.Unlock()
+}
+
+// takeUnpolled returns at most max records kept by unpoll, or all of them if max is not positive.
+func (c *Client) takeUnpolled(max int) []*kgo.Record {
+	c.unpolledMu.Lock()
+	defer c.unpolledMu.Unlock()
+
+	n := len(c.unpolled)
+	if max > 0 {
+		n = min(n, max)
 	}
 
-	fetches.EachRecord(func(record *kgo.Record) {
-		fn(record)
-	})
+	records := c.unpolled[:n:n]
+	c.unpolled = c.unpolled[n:]
 
-	return nil
+	return records
 }
 
-func (c *Client) FetchRecords() ([]*kgo.Record, error) {
-	if c.consumerRunning {
-		return nil, fmt.Errorf("background consumer running")
+// poll fetches the next records.
+func (c *Client) poll(ctx context.Context) ([]*kgo.Record, error) {
+	return c.pollMax(ctx, c.maxFetches)
+}
+
+// pollMax is like poll, but fetches at most max records. Records are neither throttled nor passed through
+// the middlewares yet, see handle and collect.
+func (c *Client) pollMax(ctx context.Context, max int) ([]*kgo.Record, error) {
+	if c.consumerRunning.Load() {
+		return nil, ErrConsumerRunning
 	}
 
-	fetches := c.client.PollRecords(nil, c.maxFetches)
+	if records := c.takeUnpolled(max); len(records) > 0 {
+		return records, nil
+	}
+
+	fetches := c.client.PollRecords(ctx, max)
 	if fetches.IsClientClosed() {
 		return nil, kgo.ErrClientClosed
 	}
@@ -179,22 +277,42 @@ func (c *Client) FetchRecords() ([]*kgo.Record, error) {
 		return nil, fetches.Err0()
 	}
 
+	c.markPoll()
+
 	return fetches.Records(), nil
 }
 
-func (c *Client) FetchRecordsContext(ctx context.Context) ([]*kgo.Record, error) {
-	if c.consumerRunning {
-		return nil, fmt.Errorf("background consumer running")
+// Deprecated: use Records.
+func (c *Client) PollRecords(fn func(r Record)) error {
+	return c.PollRecordsContext(c.client.Context(), fn)
+}
+
+// Deprecated: use Records.
+func (c *Client) PollRecordsContext(ctx context.Context, fn func(r Record)) error {
+	records, err := c.poll(ctx)
+	if err != nil {
+		return err
 	}
 
-	fetches := c.client.PollRecords(ctx, c.maxFetches)
-	if fetches.IsClientClosed() {
-		return nil, kgo.ErrClientClosed
+	handler := c.wrap(fn)
+	for _, r := range records {
+		c.handle(ctx, r, handler)
 	}
 
-	if errs := fetches.Errors(); len(errs) > 0 {
-		return nil, fetches.Err0()
+	return nil
+}
+
+// Deprecated: use Records.
+func (c *Client) FetchRecords() ([]*kgo.Record, error) {
+	return c.FetchRecordsContext(c.client.Context())
+}
+
+// Deprecated: use Records.
+func (c *Client) FetchRecordsContext(ctx context.Context) ([]*kgo.Record, error) {
+	records, err := c.poll(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return fetches.Records(), nil
+	return c.collect(ctx, records), nil
 }
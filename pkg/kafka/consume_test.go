@@ -0,0 +1,183 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestRecords(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+	cluster.ProduceValues("bookings", "a", "b", "c")
+
+	var events []string
+	client := cluster.NewClient(
+		kafka.WithMaxFetchCount(10),
+		kafka.WithMiddleware(func(next kafka.HandlerFunc) kafka.HandlerFunc {
+			return func(r kafka.Record) {
+				events = append(events, "before "+string(r.Value))
+				next(r)
+				events = append(events, "after "+string(r.Value))
+			}
+		}),
+	)
+	client.AddConsumeTopic("bookings")
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	for r, err := range client.Records(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, "handle "+string(r.Value))
+		if string(r.Value) == "a" {
+			break
+		}
+	}
+
+	want := []string{"before a", "handle a", "after a"}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] || events[2] != want[2] {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+
+	var values []string
+	for r, err := range client.Records(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values = append(values, string(r.Value))
+		if len(values) == 2 {
+			break
+		}
+	}
+
+	if len(values) != 2 || values[0] != "b" || values[1] != "c" {
+		t.Errorf("got values %v after break, want [b c]", values)
+	}
+}
+
+func TestConsumerHandlesUnyieldedRecords(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+	cluster.ProduceValues("bookings", "a", "b", "c")
+
+	recorder := kafkatest.NewRecorder()
+	client := cluster.NewClient(
+		kafka.WithMaxFetchCount(10),
+		kafka.WithSubscriptions(kafka.Subscriptions{"bookings": recorder.Handler()}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	for r, err := range client.Records(ctx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(r.Value) == "a" {
+			break
+		}
+	}
+
+	// The records polled but not yielded are handled by the background consumer.
+	client.StartConsumer(ctx)
+
+	records := recorder.WaitFor(t, 2)
+	if string(records[0].Value) != "b" || string(records[1].Value) != "c" {
+		t.Errorf("got values %q and %q, want b and c", records[0].Value, records[1].Value)
+	}
+}
+
+func TestRecordsWhileConsumerRunning(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	client := cluster.NewClient(kafka.WithSubscriptions(kafka.Subscriptions{
+		"bookings": func(kafka.Record) {},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client.StartConsumer(ctx)
+
+	done := make(chan []error, 1)
+	go func() {
+		var errs []error
+		for _, err := range client.Records(ctx) {
+			errs = append(errs, err)
+		}
+		done <- errs
+	}()
+
+	select {
+	case errs := <-done:
+		if len(errs) != 1 || !errors.Is(errs[0], kafka.ErrConsumerRunning) {
+			t.Errorf("got errors %v, want a single %v", errs, kafka.ErrConsumerRunning)
+		}
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Fatal("iteration did not end")
+	}
+}
+
+func TestRecordsBackoff(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	cluster.Fake().ControlKey(int16(kmsg.Fetch), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.Fake().KeepControl()
+
+		fetch := req.(*kmsg.FetchRequest)
+		resp := fetch.ResponseKind().(*kmsg.FetchResponse)
+		resp.SetVersion(fetch.GetVersion())
+
+		for _, rt := range fetch.Topics {
+			st := kmsg.NewFetchResponseTopic()
+			st.Topic = rt.Topic
+			st.TopicID = rt.TopicID
+
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewFetchResponseTopicPartition()
+				sp.Partition = rp.Partition
+				sp.ErrorCode = kerr.TopicAuthorizationFailed.Code
+				st.Partitions = append(st.Partitions, sp)
+			}
+
+			resp.Topics = append(resp.Topics, st)
+		}
+
+		return resp, nil, true
+	})
+
+	client := cluster.NewClient()
+	client.AddConsumeTopic("bookings")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	errs := 0
+	for _, err := range client.Records(ctx) {
+		if !errors.Is(err, kerr.TopicAuthorizationFailed) {
+			t.Fatalf("got error %v, want %v", err, kerr.TopicAuthorizationFailed)
+		}
+
+		errs++
+	}
+
+	// Backing off 100ms, 200ms, 400ms, ... allows a few attempts per second.
+	if errs == 0 || errs > 5 {
+		t.Errorf("got %d errors within a second, want 1 to 5", errs)
+	}
+}
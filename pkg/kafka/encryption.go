@@ -0,0 +1,324 @@
+package kafka
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderEncryptionKeyID holds the ID of the key that wrapped the data key of an encrypted record.
+	HeaderEncryptionKeyID = "enc-key-id"
+	// HeaderEncryptionDataKey holds the wrapped data key of an encrypted record.
+	HeaderEncryptionDataKey = "enc-dek"
+	// HeaderEncryptionAlgorithm holds the algorithm used to encrypt the record value.
+	HeaderEncryptionAlgorithm = "enc-alg"
+
+	encryptionAlgorithm    = "A256GCM"
+	dataKeySize            = 32
+	maxCachedDataKeys      = 1024
+	defaultDataKeyRotation = time.Hour
+)
+
+// KeyProvider wraps and unwraps data encryption keys with a key encryption key, e.g. a Key Vault key.
+type KeyProvider interface {
+	// WrapKey encrypts the data key and returns the ID of the key used for wrapping.
+	WrapKey(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped by the key with the given ID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+type EncryptionOpt func(*encryptor)
+
+// WithDataKeyRotation sets how long a data key is reused before a new one is created, which calls the key
+// provider. Defaults to one hour; zero or a negative duration creates a data key per record.
+func WithDataKeyRotation(d time.Duration) EncryptionOpt {
+	return func(e *encryptor) {
+		e.rotation = d
+	}
+}
+
+// WithEncryptedTopics restricts encryption to the given topics. By default, records of all topics are encrypted.
+func WithEncryptedTopics(topics ...string) EncryptionOpt {
+	return func(e *encryptor) {
+		if e.topics == nil {
+			e.topics = make(map[string]struct{})
+		}
+
+		for _, t := range topics {
+			e.topics[t] = struct{}{}
+		}
+	}
+}
+
+// WithEncryption encrypts record values with AES-256-GCM using a data key that is wrapped by the key provider.
+// The wrapped data key and the key ID are stored in the record headers. Consumed encrypted records are decrypted
+// before they are passed to the handler. Records failing to decrypt are not passed to the handler; pull-style
+// consumers receive them with the error, otherwise the error is reported to the error handler.
+// Records without encryption headers and tombstones are passed through unchanged.
+//
+// The topic and key of a record are authenticated with its value, so an encrypted value cannot be moved to another
+// topic or key. Register options that change the topic, like WithTenancy, before WithEncryption.
+func WithEncryption(provider KeyProvider, opts ...EncryptionOpt) Opt {
+	e := &encryptor{
+		provider: provider,
+		rotation: defaultDataKeyRotation,
+		cache:    make(map[string][]byte),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, e.encrypt)
+		c.middlewares = append(c.middlewares, e.middleware(c))
+	}
+}
+
+type dataKey struct {
+	plain   []byte
+	wrapped []byte
+	keyID   string
+	created time.Time
+}
+
+type encryptor struct {
+	provider KeyProvider
+	rotation time.Duration
+	topics   map[string]struct{}
+
+	mu      sync.Mutex
+	current *dataKey
+
+	cacheMu sync.Mutex
+	cache   map[string][]byte
+}
+
+func (e *encryptor) encrypt(ctx context.Context, r Record) error {
+	if r.Value == nil {
+		return nil
+	}
+
+	if e.topics != nil {
+		if _, ok := e.topics[r.Topic]; !ok {
+			return nil
+		}
+	}
+
+	key, err := e.dataKey(ctx)
+	if err != nil {
+		return fmt.Errorf("encryption: data key: %w", err)
+	}
+
+	sealed, err := seal(key.plain, r.Value, recordAAD(r))
+	if err != nil {
+		return fmt.Errorf("encryption: %w", err)
+	}
+
+	r.Value = sealed
+	SetHeader(r, HeaderEncryptionAlgorithm, []byte(encryptionAlgorithm))
+	SetHeader(r, HeaderEncryptionKeyID, []byte(key.keyID))
+	SetHeader(r, HeaderEncryptionDataKey, key.wrapped)
+
+	return nil
+}
+
+// dataKey returns the current data key, creating a new one if rotation is disabled or the current key expired.
+// The key provider is called without holding the lock, so producers do not wait for each other; producers
+// rotating concurrently may each create a key, the last one is kept.
+func (e *encryptor) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	current := e.current
+	e.mu.Unlock()
+
+	if e.rotation > 0 && current != nil && time.Since(current.created) < e.rotation {
+		return current, nil
+	}
+
+	plain := make([]byte, dataKeySize)
+	if _, err := rand.Read(plain); err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := e.provider.WrapKey(ctx, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &dataKey{plain: plain, wrapped: wrapped, keyID: keyID, created: time.Now()}
+	if e.rotation > 0 {
+		e.mu.Lock()
+		e.current = key
+		e.mu.Unlock()
+	}
+
+	return key, nil
+}
+
+func (e *encryptor) decrypt(ctx context.Context, r Record) error {
+	alg, _ := HeaderValue(r, HeaderEncryptionAlgorithm)
+	if string(alg) != encryptionAlgorithm {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	keyID, _ := HeaderValue(r, HeaderEncryptionKeyID)
+	wrapped, ok := HeaderValue(r, HeaderEncryptionDataKey)
+	if !ok {
+		return errors.New("missing data key")
+	}
+
+	plainKey, err := e.unwrap(ctx, string(keyID), wrapped)
+	if err != nil {
+		return fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	value, err := open(plainKey, r.Value, recordAAD(r))
+	if err != nil {
+		return err
+	}
+
+	r.Value = value
+	DeleteHeader(r, HeaderEncryptionAlgorithm)
+	DeleteHeader(r, HeaderEncryptionKeyID)
+	DeleteHeader(r, HeaderEncryptionDataKey)
+
+	return nil
+}
+
+// unwrap returns the plain data key, using a cache to avoid calling the key provider for every record
+// encrypted with a rotating data key.
+func (e *encryptor) unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	cacheKey := keyID + "|" + string(wrapped)
+
+	e.cacheMu.Lock()
+	plain, ok := e.cache[cacheKey]
+	e.cacheMu.Unlock()
+
+	if ok {
+		return plain, nil
+	}
+
+	plain, err := e.provider.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	e.cacheMu.Lock()
+	if len(e.cache) >= maxCachedDataKeys {
+		clear(e.cache)
+	}
+	e.cache[cacheKey] = plain
+	e.cacheMu.Unlock()
+
+	return plain, nil
+}
+
+func (e *encryptor) middleware(c *Client) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Record) {
+			if _, ok := HeaderValue(r, HeaderEncryptionAlgorithm); !ok {
+				next(r)
+				return
+			}
+
+			if err := e.decrypt(c.recordContext(r), r); err != nil {
+				c.fail(r, fmt.Errorf("encryption: decrypt %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+				return
+			}
+
+			next(r)
+		}
+	}
+}
+
+// LocalKeyProvider wraps data keys with AES-256-GCM using static keys held in memory.
+// It is meant for tests and local development without Key Vault.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewLocalKeyProvider returns a provider wrapping new data keys with the key current. All keys must be
+// 32 bytes long. Keys other than current are only used to unwrap data keys of older records.
+func NewLocalKeyProvider(current string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("unknown key %q", current)
+	}
+
+	for id, key := range keys {
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %q: got %d bytes, want %d", id, len(key), dataKeySize)
+		}
+	}
+
+	return &LocalKeyProvider{current: current, keys: keys}, nil
+}
+
+func (p *LocalKeyProvider) WrapKey(_ context.Context, dek []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.current], dek, nil)
+
+	return p.current, wrapped, err
+}
+
+func (p *LocalKeyProvider) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+
+	return open(key, wrapped, nil)
+}
+
+// recordAAD returns the additional data authenticated with the value: the length-prefixed topic and the key.
+func recordAAD(r Record) []byte {
+	aad := binary.BigEndian.AppendUint32(nil, uint32(len(r.Topic)))
+	aad = append(aad, r.Topic...)
+
+	return append(aad, r.Key...)
+}
+
+// seal encrypts plaintext with AES-GCM and returns the random nonce followed by the ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
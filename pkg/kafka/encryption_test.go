@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newTestEncryptor(t *testing.T, opts ...EncryptionOpt) *encryptor {
+	t.Helper()
+
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &encryptor{provider: provider, rotation: defaultDataKeyRotation, cache: make(map[string][]byte)}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+func TestEncryptionRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEncryptor(t)
+	c := &Client{onError: func(err error) { t.Error(err) }}
+
+	r := &kgo.Record{Topic: "occupancy", Value: []byte("room 4.12 occupied"), Context: ctx}
+	if err := e.encrypt(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(r.Value, []byte("occupied")) {
+		t.Fatal("value not encrypted")
+	}
+
+	if keyID, _ := HeaderValue(r, HeaderEncryptionKeyID); string(keyID) != "k1" {
+		t.Errorf("got key ID %q, want k1", keyID)
+	}
+
+	var got Record
+	e.middleware(c)(func(r Record) { got = r })(r)
+
+	if got == nil || string(got.Value) != "room 4.12 occupied" {
+		t.Fatalf("decryption failed, got %v", got)
+	}
+
+	if len(got.Headers) != 0 {
+		t.Errorf("encryption headers not removed: %v", got.Headers)
+	}
+}
+
+func TestEncryptionRejectsTamperedRecord(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEncryptor(t)
+
+	var reported error
+	c := &Client{onError: func(err error) { reported = err }}
+
+	r := &kgo.Record{Topic: "occupancy", Value: []byte("secret"), Context: ctx}
+	if err := e.encrypt(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Value[len(r.Value)-1] ^= 0xff
+
+	e.middleware(c)(func(r Record) { t.Error("tampered record passed to handler") })(r)
+
+	if reported == nil {
+		t.Error("expected decryption error")
+	}
+}
+
+func TestEncryptionDataKeyRotation(t *testing.T) {
+	tests := []struct {
+		rotation time.Duration
+		reused   bool
+	}{
+		{defaultDataKeyRotation, true},
+		{0, false},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		e := newTestEncryptor(t, WithDataKeyRotation(tt.rotation))
+
+		first, second := &kgo.Record{Value: []byte("a")}, &kgo.Record{Value: []byte("b")}
+		if err := e.encrypt(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.encrypt(ctx, second); err != nil {
+			t.Fatal(err)
+		}
+
+		k1, _ := HeaderValue(first, HeaderEncryptionDataKey)
+		k2, _ := HeaderValue(second, HeaderEncryptionDataKey)
+		if bytes.Equal(k1, k2) != tt.reused {
+			t.Errorf("got data key reused %t with rotation %v, want %t", bytes.Equal(k1, k2), tt.rotation, tt.reused)
+		}
+	}
+}
+
+func TestEncryptionAuthenticatesTopicAndKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *kgo.Record)
+	}{
+		{"topic", func(r *kgo.Record) { r.Topic = "bookings" }},
+		{"key", func(r *kgo.Record) { r.Key = []byte("room 4.13") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			e := newTestEncryptor(t)
+
+			var reported error
+			c := &Client{onError: func(err error) { reported = err }}
+
+			r := &kgo.Record{Topic: "occupancy", Key: []byte("room 4.12"), Value: []byte("occupied"), Context: ctx}
+			if err := e.encrypt(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.modify(r)
+
+			e.middleware(c)(func(r Record) { t.Error("moved record passed to handler") })(r)
+
+			if reported == nil {
+				t.Error("expected decryption error")
+			}
+		})
+	}
+}
+
+// blockingKeyProvider blocks WrapKey until released.
+type blockingKeyProvider struct {
+	KeyProvider
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingKeyProvider) WrapKey(ctx context.Context, dek []byte) (string, []byte, error) {
+	p.entered <- struct{}{}
+	<-p.release
+
+	return p.KeyProvider.WrapKey(ctx, dek)
+}
+
+func TestEncryptionWrapsKeysConcurrently(t *testing.T) {
+	e := newTestEncryptor(t)
+	provider := &blockingKeyProvider{
+		KeyProvider: e.provider,
+		entered:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	e.provider = provider
+
+	var wg sync.WaitGroup
+	for _, value := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := e.encrypt(context.Background(), &kgo.Record{Value: []byte(value)}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Both producers reach the key provider, so none of them waits for the other while the key is wrapped.
+	for range 2 {
+		select {
+		case <-provider.entered:
+		case <-time.After(time.Second):
+			t.Fatal("producer waited for another producer to wrap its data key")
+		}
+	}
+
+	close(provider.release)
+	wg.Wait()
+}
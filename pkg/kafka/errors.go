@@ -8,6 +8,9 @@ import (
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
+// ErrConsumerRunning is returned by pull-style consumption while the background consumer is running.
+var ErrConsumerRunning = errors.New("background consumer running")
+
 type ConsumerError struct {
 	err         error
 	desc        string
@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Health is a snapshot of the client state suitable for readiness probes.
+// All fields are JSON serializable.
+type Health struct {
+	Ready    bool           `json:"ready"`
+	Brokers  BrokerHealth   `json:"brokers"`
+	Group    *GroupHealth   `json:"group,omitempty"`
+	Consumer ConsumerHealth `json:"consumer"`
+	Producer ProducerHealth `json:"producer"`
+}
+
+type BrokerHealth struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// GroupHealth describes the consumer group membership. It is nil in Health if the client is not part of a group.
+type GroupHealth struct {
+	Group      string `json:"group"`
+	MemberID   string `json:"member_id,omitempty"`
+	Generation int32  `json:"generation"`
+	Joined     bool   `json:"joined"`
+}
+
+type ConsumerHealth struct {
+	Running         bool          `json:"running"`
+	LastPoll        *time.Time    `json:"last_poll,omitempty"`
+	SinceLastPoll   time.Duration `json:"since_last_poll,omitempty"`
+	LastCommit      *time.Time    `json:"last_commit,omitempty"`
+	SinceLastCommit time.Duration `json:"since_last_commit,omitempty"`
+}
+
+type ProducerHealth struct {
+	BufferedRecords    int64   `json:"buffered_records"`
+	MaxBufferedRecords int64   `json:"max_buffered_records"`
+	BufferedBytes      int64   `json:"buffered_bytes"`
+	MaxBufferedBytes   int64   `json:"max_buffered_bytes,omitempty"`
+	BufferFill         float64 `json:"buffer_fill"`
+}
+
+// Health pings the brokers and collects the state of the consumer and producer.
+//
+// The client is reported as ready if the brokers are reachable and, when a consumer group is configured,
+// the client has joined the group.
+func (c *Client) Health(ctx context.Context) Health {
+	now := time.Now()
+	h := Health{}
+
+	if err := c.ping(ctx); err != nil {
+		h.Brokers.Error = err.Error()
+	} else {
+		h.Brokers.Reachable = true
+	}
+
+	if c.group != "" {
+		memberID, generation := c.client.GroupMetadata()
+		h.Group = &GroupHealth{
+			Group:      c.group,
+			MemberID:   memberID,
+			Generation: generation,
+			Joined:     generation >= 0 && memberID != "",
+		}
+	}
+
+	h.Consumer.Running = c.consumerRunning.Load()
+	if t := loadTime(&c.lastPoll); t != nil {
+		h.Consumer.LastPoll = t
+		h.Consumer.SinceLastPoll = now.Sub(*t)
+	}
+	if t := loadTime(&c.lastCommit); t != nil {
+		h.Consumer.LastCommit = t
+		h.Consumer.SinceLastCommit = now.Sub(*t)
+	}
+
+	h.Producer.BufferedRecords = c.client.BufferedProduceRecords()
+	h.Producer.BufferedBytes = c.client.BufferedProduceBytes()
+	h.Producer.MaxBufferedRecords, _ = c.client.OptValue(kgo.MaxBufferedRecords).(int64)
+	h.Producer.MaxBufferedBytes, _ = c.client.OptValue(kgo.MaxBufferedBytes).(int64)
+	h.Producer.BufferFill = bufferFill(h.Producer)
+
+	h.Ready = h.Brokers.Reachable && (h.Group == nil || h.Group.Joined)
+
+	return h
+}
+
+// bufferFill returns the fill ratio of the producer buffer, taking whichever limit is closer to being reached.
+func bufferFill(p ProducerHealth) float64 {
+	var fill float64
+	if p.MaxBufferedRecords > 0 {
+		fill = float64(p.BufferedRecords) / float64(p.MaxBufferedRecords)
+	}
+
+	if p.MaxBufferedBytes > 0 {
+		fill = max(fill, float64(p.BufferedBytes)/float64(p.MaxBufferedBytes))
+	}
+
+	return fill
+}
+
+func (c *Client) markPoll() {
+	c.lastPoll.Store(time.Now().UnixNano())
+}
+
+func (c *Client) markCommit() {
+	c.lastCommit.Store(time.Now().UnixNano())
+}
+
+func loadTime(v interface{ Load() int64 }) *time.Time {
+	ns := v.Load()
+	if ns == 0 {
+		return nil
+	}
+
+	t := time.Unix(0, ns)
+
+	return &t
+}
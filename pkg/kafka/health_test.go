@@ -0,0 +1,68 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+)
+
+func TestHealth(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	recorder := kafkatest.NewRecorder()
+	client := cluster.NewClient(
+		kafka.WithGroup("health"),
+		kafka.WithSubscriptions(kafka.Subscriptions{"bookings": recorder.Handler()}),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	h := client.Health(ctx)
+	if h.Ready || h.Consumer.Running || h.Consumer.LastPoll != nil {
+		t.Errorf("got %+v before consuming, want not ready and not running", h)
+	}
+
+	if !h.Brokers.Reachable || h.Group == nil || h.Group.Group != "health" {
+		t.Errorf("got brokers %+v and group %+v, want reachable brokers and group health", h.Brokers, h.Group)
+	}
+
+	client.StartConsumer(ctx)
+	cluster.ProduceValues("bookings", "a")
+	recorder.WaitFor(t, 1)
+
+	// Health is read while the consumer runs, which the race detector checks.
+	for {
+		h = client.Health(ctx)
+		if h.Ready {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %+v, want ready after joining the group", h)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if !h.Consumer.Running || h.Consumer.LastPoll == nil || !h.Group.Joined {
+		t.Errorf("got consumer %+v and group %+v, want a running consumer in the joined group", h.Consumer, h.Group)
+	}
+}
+
+func TestHealthUnreachableBrokers(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	client := cluster.NewClient()
+	cluster.Fake().Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if h := client.Health(ctx); h.Ready || h.Brokers.Reachable || h.Brokers.Error == "" {
+		t.Errorf("got brokers %+v and ready %t, want unreachable brokers with an error", h.Brokers, h.Ready)
+	}
+}
@@ -0,0 +1,30 @@
+package kafka_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+)
+
+// testPool connects to the database in POSTGRES_TEST_DSN and skips the test if it is not set.
+func testPool(t *testing.T) *postgres.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	pool, err := postgres.NewPool(context.Background(), postgres.WithDSN(dsn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = pool.Close(context.Background())
+	})
+
+	return pool
+}
@@ -0,0 +1,282 @@
+// Package kafkatest runs an in-process Kafka cluster for tests of services built on pkg/kafka.
+package kafkatest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	DefaultTimeout    = 10 * time.Second
+	defaultPartitions = 1
+	pollInterval      = 10 * time.Millisecond
+)
+
+// Cluster is a fake Kafka cluster that is closed when the test finishes.
+type Cluster struct {
+	t       testing.TB
+	cluster *kfake.Cluster
+	raw     *kgo.Client
+	admin   *kadm.Client
+}
+
+// NewCluster starts a fake cluster. Topics are created with one partition when they are first produced to with
+// the Produce helpers. Create topics used by a kafka.Client up front with SeedTopics.
+func NewCluster(t testing.TB, opts ...kfake.Opt) *Cluster {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(append([]kfake.Opt{
+		kfake.AllowAutoTopicCreation(),
+		kfake.DefaultNumPartitions(defaultPartitions),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("kafkatest: start cluster: %v", err)
+	}
+
+	raw, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.AllowAutoTopicCreation(),
+	)
+	if err != nil {
+		cluster.Close()
+		t.Fatalf("kafkatest: create client: %v", err)
+	}
+
+	c := &Cluster{
+		t:       t,
+		cluster: cluster,
+		raw:     raw,
+		admin:   kadm.NewClient(raw),
+	}
+
+	t.Cleanup(func() {
+		raw.Close()
+		cluster.Close()
+	})
+
+	return c
+}
+
+// Addrs returns the addresses of the brokers.
+func (c *Cluster) Addrs() []string {
+	return c.cluster.ListenAddrs()
+}
+
+// Fake returns the underlying kfake cluster, e.g. to inject failures with Control.
+func (c *Cluster) Fake() *kfake.Cluster {
+	return c.cluster
+}
+
+// NewClient returns a ready kafka.Client connected to the cluster. The client is closed when the test finishes.
+func (c *Cluster) NewClient(opts ...kafka.Opt) *kafka.Client {
+	c.t.Helper()
+
+	client, err := kafka.New(append([]kafka.Opt{kafka.Seeds(c.Addrs()...)}, opts...)...)
+	if err != nil {
+		c.t.Fatalf("kafkatest: create kafka client: %v", err)
+	}
+
+	c.t.Cleanup(client.Close)
+
+	return client
+}
+
+// SeedTopics creates topics with the given number of partitions.
+func (c *Cluster) SeedTopics(partitions int32, topics ...string) {
+	c.t.Helper()
+
+	resp, err := c.admin.CreateTopics(context.Background(), partitions, 1, nil, topics...)
+	if err == nil {
+		err = resp.Error()
+	}
+	if err != nil {
+		c.t.Fatalf("kafkatest: create topics %v: %v", topics, err)
+	}
+}
+
+// Produce synchronously produces the records, bypassing interceptors of any kafka.Client.
+func (c *Cluster) Produce(records ...*kgo.Record) {
+	c.t.Helper()
+
+	if err := c.raw.ProduceSync(context.Background(), records...).FirstErr(); err != nil {
+		c.t.Fatalf("kafkatest: produce: %v", err)
+	}
+}
+
+// ProduceValues produces one record per value to the topic.
+func (c *Cluster) ProduceValues(topic string, values ...string) {
+	c.t.Helper()
+
+	records := make([]*kgo.Record, len(values))
+	for i, v := range values {
+		records[i] = &kgo.Record{Topic: topic, Value: []byte(v)}
+	}
+
+	c.Produce(records...)
+}
+
+// ConsumeAll reads all records currently in the topic, e.g. to check what a service produced.
+func (c *Cluster) ConsumeAll(topic string) []*kgo.Record {
+	c.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	starts, err := c.admin.ListStartOffsets(ctx, topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		c.t.Fatalf("kafkatest: list start offsets of %q: %v", topic, err)
+	}
+
+	ends, err := c.admin.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		c.t.Fatalf("kafkatest: list end offsets of %q: %v", topic, err)
+	}
+
+	// Records before the start offset were deleted or expired.
+	var want int64
+	ends.Each(func(end kadm.ListedOffset) {
+		start, _ := starts.Lookup(end.Topic, end.Partition)
+		want += max(0, end.Offset-start.Offset)
+	})
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(c.Addrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		c.t.Fatalf("kafkatest: create consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	var records []*kgo.Record
+	for int64(len(records)) < want {
+		fetches := consumer.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			c.t.Fatalf("kafkatest: consumed %d of %d records of %q: %v", len(records), want, topic, err)
+		}
+
+		records = append(records, fetches.Records()...)
+	}
+
+	return records
+}
+
+// CommittedOffset returns the committed offset of the group for the partition, or -1 if there is none.
+func (c *Cluster) CommittedOffset(group string, topic string, partition int32) int64 {
+	c.t.Helper()
+
+	offsets, err := c.admin.FetchOffsets(context.Background(), group)
+	if err != nil {
+		c.t.Fatalf("kafkatest: fetch offsets of group %q: %v", group, err)
+	}
+
+	o, ok := offsets.Lookup(topic, partition)
+	if !ok || o.Err != nil {
+		return -1
+	}
+
+	return o.At
+}
+
+// AssertCommitted waits until the group committed the offset for the partition and fails the test on timeout.
+// The offset is the offset of the next record to consume, i.e. the last processed offset plus one.
+func (c *Cluster) AssertCommitted(group string, topic string, partition int32, want int64) {
+	c.t.Helper()
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		got := c.CommittedOffset(group, topic, partition)
+		if got == want {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			c.t.Fatalf("kafkatest: group %q committed offset %d for %s/%d, want %d", group, got, topic, partition, want)
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Recorder collects records handled by a consumer so tests can wait for them.
+type Recorder struct {
+	mu      sync.Mutex
+	records []kafka.Record
+	changed chan struct{}
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{changed: make(chan struct{})}
+}
+
+// Middleware records every record after the handler returned. Pass it with kafka.WithMiddleware.
+func (r *Recorder) Middleware(next kafka.HandlerFunc) kafka.HandlerFunc {
+	return func(record kafka.Record) {
+		next(record)
+		r.add(record)
+	}
+}
+
+// Handler returns a handler that only records. Use it for subscriptions without handler logic.
+func (r *Recorder) Handler() kafka.HandlerFunc {
+	return r.add
+}
+
+func (r *Recorder) add(record kafka.Record) {
+	r.mu.Lock()
+	r.records = append(r.records, record)
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.mu.Unlock()
+}
+
+// Records returns a copy of all recorded records.
+func (r *Recorder) Records() []kafka.Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]kafka.Record(nil), r.records...)
+}
+
+// WaitFor waits until at least n records were recorded and returns them. It fails the test after DefaultTimeout.
+func (r *Recorder) WaitFor(t testing.TB, n int) []kafka.Record {
+	t.Helper()
+
+	timeout := time.NewTimer(DefaultTimeout)
+	defer timeout.Stop()
+
+	for {
+		r.mu.Lock()
+		if len(r.records) >= n {
+			records := append([]kafka.Record(nil), r.records...)
+			r.mu.Unlock()
+
+			return records
+		}
+
+		changed := r.changed
+		got := len(r.records)
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			t.Fatalf("kafkatest: got %d records, want %d", got, n)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package kafkatest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func TestSubscriptionsWithManualCommit(t *testing.T) {
+	cluster := NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	recorder := NewRecorder()
+
+	var handled []string
+	client := cluster.NewClient(
+		kafka.WithGroup("booking-service"),
+		kafka.WithManualCommit(),
+		kafka.WithMiddleware(recorder.Middleware),
+		kafka.WithSubscriptions(kafka.Subscriptions{
+			"bookings": func(r kafka.Record) {
+				handled = append(handled, string(r.Value))
+			},
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client.StartConsumer(ctx)
+
+	cluster.ProduceValues("bookings", "a", "b", "c")
+
+	records := recorder.WaitFor(t, 3)
+	client.CommitRecords(records...)
+
+	cluster.AssertCommitted("booking-service", "bookings", 0, 3)
+
+	if len(handled) != 3 || handled[0] != "a" || handled[2] != "c" {
+		t.Errorf("got handled values %v, want [a b c]", handled)
+	}
+}
+
+func TestProduceWithCorrelationID(t *testing.T) {
+	cluster := NewCluster(t)
+	cluster.SeedTopics(1, "reminders")
+	client := cluster.NewClient()
+
+	done := make(chan error, 1)
+	r := kafka.NewRecord()
+	r.Topic = "reminders"
+	r.Value = []byte("due")
+	r.Context = kafka.ContextWithCorrelationID(context.Background(), "req-42")
+
+	client.ProduceCallback(r, func(_ kafka.Record, err error) {
+		done <- err
+	})
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	records := cluster.ConsumeAll("reminders")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+
+	if id, _ := kafka.HeaderValue(records[0], kafka.HeaderCorrelationID); string(id) != "req-42" {
+		t.Errorf("got correlation ID %q, want req-42", id)
+	}
+}
+
+func TestConsumeAllAfterDeletedRecords(t *testing.T) {
+	cluster := NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+	cluster.ProduceValues("bookings", "a", "b", "c")
+
+	var offsets kadm.Offsets
+	offsets.Add(kadm.Offset{Topic: "bookings", Partition: 0, At: 2})
+
+	resp, err := cluster.admin.DeleteRecords(context.Background(), offsets)
+	if err == nil {
+		err = resp.Error()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := cluster.ConsumeAll("bookings")
+	if len(records) != 1 || string(records[0].Value) != "c" {
+		t.Errorf("got %d records, want only c", len(records))
+	}
+}
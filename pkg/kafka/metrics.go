@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// MetricLabels identifies the topic partition and consumer group a metric belongs to.
+// Partition is -1 if unknown and Group is empty for clients without a consumer group.
+type MetricLabels struct {
+	Topic     string
+	Partition int32
+	Group     string
+}
+
+// Metrics receives measurements of a client. See the metrics package for a Prometheus implementation.
+type Metrics interface {
+	// ObserveProduce is called when a record was acknowledged by the broker or failed.
+	// The latency is measured from buffering the record in the client.
+	ObserveProduce(l MetricLabels, latency time.Duration, err error)
+	// ObserveFetch is called for every fetched batch with the number of records and uncompressed bytes.
+	ObserveFetch(l MetricLabels, records int, bytes int)
+	// ObserveHandler is called after a handler returned.
+	ObserveHandler(l MetricLabels, d time.Duration)
+	// ObserveThrottle is called when a rate limit delayed consuming or producing.
+	ObserveThrottle(l MetricLabels, direction string, d time.Duration)
+	// IncBrokerError is called for failed connects, reads and writes of a broker.
+	IncBrokerError(broker string, op string)
+}
+
+const (
+	ThrottleDirectionConsume = "consume"
+	ThrottleDirectionProduce = "produce"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveProduce(MetricLabels, time.Duration, error)   {}
+func (noopMetrics) ObserveFetch(MetricLabels, int, int)                 {}
+func (noopMetrics) ObserveHandler(MetricLabels, time.Duration)          {}
+func (noopMetrics) ObserveThrottle(MetricLabels, string, time.Duration) {}
+func (noopMetrics) IncBrokerError(string, string)                       {}
+
+// metricsHooks reports client internals from franz-go hooks.
+type metricsHooks struct {
+	c        *Client
+	buffered sync.Map // *kgo.Record -> time.Time
+}
+
+var (
+	_ kgo.HookProduceRecordBuffered   = (*metricsHooks)(nil)
+	_ kgo.HookProduceRecordUnbuffered = (*metricsHooks)(nil)
+	_ kgo.HookFetchBatchRead          = (*metricsHooks)(nil)
+	_ kgo.HookBrokerConnect           = (*metricsHooks)(nil)
+	_ kgo.HookBrokerRead              = (*metricsHooks)(nil)
+	_ kgo.HookBrokerWrite             = (*metricsHooks)(nil)
+)
+
+func (h *metricsHooks) OnProduceRecordBuffered(r *kgo.Record) {
+	h.buffered.Store(r, time.Now())
+}
+
+func (h *metricsHooks) OnProduceRecordUnbuffered(r *kgo.Record, err error) {
+	started, ok := h.buffered.LoadAndDelete(r)
+	if !ok {
+		return
+	}
+
+	h.c.metrics.ObserveProduce(h.c.labels(r.Topic, r.Partition), time.Since(started.(time.Time)), err)
+}
+
+func (h *metricsHooks) OnFetchBatchRead(_ kgo.BrokerMetadata, topic string, partition int32, m kgo.FetchBatchMetrics) {
+	h.c.metrics.ObserveFetch(h.c.labels(topic, partition), m.NumRecords, m.UncompressedBytes)
+}
+
+func (h *metricsHooks) OnBrokerConnect(meta kgo.BrokerMetadata, _ time.Duration, _ net.Conn, err error) {
+	if err != nil {
+		h.c.metrics.IncBrokerError(brokerLabel(meta), "connect")
+	}
+}
+
+func (h *metricsHooks) OnBrokerRead(meta kgo.BrokerMetadata, _ int16, _ int, _, _ time.Duration, err error) {
+	if err != nil {
+		h.c.metrics.IncBrokerError(brokerLabel(meta), "read")
+	}
+}
+
+func (h *metricsHooks) OnBrokerWrite(meta kgo.BrokerMetadata, _ int16, _ int, _, _ time.Duration, err error) {
+	if err != nil {
+		h.c.metrics.IncBrokerError(brokerLabel(meta), "write")
+	}
+}
+
+func brokerLabel(meta kgo.BrokerMetadata) string {
+	return strconv.Itoa(int(meta.NodeID))
+}
+
+func (c *Client) labels(topic string, partition int32) MetricLabels {
+	return MetricLabels{Topic: topic, Partition: partition, Group: c.group}
+}
+
+// metricsMiddleware measures the duration of the handler.
+func (c *Client) metricsMiddleware(next HandlerFunc) HandlerFunc {
+	return func(r Record) {
+		started := time.Now()
+		next(r)
+		c.metrics.ObserveHandler(c.labels(r.Topic, r.Partition), time.Since(started))
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labelNames = []string{"topic", "partition", "group"}
+
+// Prometheus implements kafka.Metrics with Prometheus collectors.
+type Prometheus struct {
+	produceLatency  *prometheus.HistogramVec
+	produceErrors   *prometheus.CounterVec
+	fetchRecords    *prometheus.CounterVec
+	fetchBytes      *prometheus.CounterVec
+	fetchBatchBytes *prometheus.HistogramVec
+	handlerDuration *prometheus.HistogramVec
+	throttled       *prometheus.CounterVec
+	brokerErrors    *prometheus.CounterVec
+}
+
+var _ kafka.Metrics = (*Prometheus)(nil)
+
+// NewPrometheus creates the collectors with the given namespace and registers them with reg.
+func NewPrometheus(reg prometheus.Registerer, namespace string) (*Prometheus, error) {
+	p := &Prometheus{
+		produceLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "produce_latency_seconds",
+			Help:      "Time from buffering a record until it was acknowledged or failed.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, labelNames),
+		produceErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "produce_errors_total",
+			Help:      "Number of records that failed to be produced.",
+		}, labelNames),
+		fetchRecords: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "fetch_records_total",
+			Help:      "Number of fetched records.",
+		}, labelNames),
+		fetchBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "fetch_bytes_total",
+			Help:      "Uncompressed bytes of fetched batches.",
+		}, labelNames),
+		fetchBatchBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "fetch_batch_bytes",
+			Help:      "Uncompressed size of fetched batches.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+		}, labelNames),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in record handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, labelNames),
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "throttled_seconds_total",
+			Help:      "Time consuming or producing was delayed by rate limits.",
+		}, []string{"topic", "group", "direction"}),
+		brokerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "kafka",
+			Name:      "broker_errors_total",
+			Help:      "Number of failed broker connects, reads and writes.",
+		}, []string{"broker", "op"}),
+	}
+
+	collectors := []prometheus.Collector{
+		p.produceLatency,
+		p.produceErrors,
+		p.fetchRecords,
+		p.fetchBytes,
+		p.fetchBatchBytes,
+		p.handlerDuration,
+		p.throttled,
+		p.brokerErrors,
+	}
+
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Prometheus) ObserveProduce(l kafka.MetricLabels, latency time.Duration, err error) {
+	values := labelValues(l)
+	p.produceLatency.WithLabelValues(values...).Observe(latency.Seconds())
+
+	if err != nil {
+		p.produceErrors.WithLabelValues(values...).Inc()
+	}
+}
+
+func (p *Prometheus) ObserveFetch(l kafka.MetricLabels, records int, bytes int) {
+	values := labelValues(l)
+	p.fetchRecords.WithLabelValues(values...).Add(float64(records))
+	p.fetchBytes.WithLabelValues(values...).Add(float64(bytes))
+	p.fetchBatchBytes.WithLabelValues(values...).Observe(float64(bytes))
+}
+
+func (p *Prometheus) ObserveHandler(l kafka.MetricLabels, d time.Duration) {
+	p.handlerDuration.WithLabelValues(labelValues(l)...).Observe(d.Seconds())
+}
+
+func (p *Prometheus) ObserveThrottle(l kafka.MetricLabels, direction string, d time.Duration) {
+	p.throttled.WithLabelValues(l.Topic, l.Group, direction).Add(d.Seconds())
+}
+
+func (p *Prometheus) IncBrokerError(broker string, op string) {
+	p.brokerErrors.WithLabelValues(broker, op).Inc()
+}
+
+func labelValues(l kafka.MetricLabels) []string {
+	return []string{l.Topic, strconv.Itoa(int(l.Partition)), l.Group}
+}
@@ -0,0 +1,194 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+var bookingLabels = map[string]string{"topic": "bookings", "partition": "0", "group": "metrics"}
+
+func TestPrometheus(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	reg := prometheus.NewRegistry()
+	p, err := metrics.NewPrometheus(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := kafkatest.NewRecorder()
+	client := cluster.NewClient(
+		kafka.WithMetrics(p),
+		kafka.WithGroup("metrics"),
+		kafka.WithSubscriptions(kafka.Subscriptions{"bookings": recorder.Handler()}),
+	)
+
+	for _, value := range []string{"a", "b"} {
+		produce(t, client, &kgo.Record{Topic: "bookings", Value: []byte(value)})
+	}
+
+	client.StartConsumer(t.Context())
+	recorder.WaitFor(t, 2)
+
+	// The handler duration is observed after the handler returned.
+	waitFor(t, func() bool {
+		return sampleCount(t, reg, "test_kafka_handler_duration_seconds", bookingLabels) == 2
+	})
+
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{"test_kafka_produce_latency_seconds", 2},
+		{"test_kafka_fetch_records_total", 2},
+		// Every record was produced in its own batch.
+		{"test_kafka_fetch_batch_bytes", 2},
+	}
+
+	for _, tt := range tests {
+		if got := sampleCount(t, reg, tt.name, bookingLabels); got != tt.want {
+			t.Errorf("got %s %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := sampleCount(t, reg, "test_kafka_fetch_bytes_total", bookingLabels); got == 0 {
+		t.Error("got no fetched bytes")
+	}
+
+	if got := sampleCount(t, reg, "test_kafka_produce_errors_total", bookingLabels); got != 0 {
+		t.Errorf("got %v produce errors, want 0", got)
+	}
+}
+
+func TestPrometheusProduceErrors(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	reg := prometheus.NewRegistry()
+	p, err := metrics.NewPrometheus(reg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := cluster.NewClient(kafka.WithMetrics(p), kafka.WithGroup("metrics"))
+
+	cluster.Fake().ControlKey(int16(kmsg.Produce), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		produce := req.(*kmsg.ProduceRequest)
+		resp := produce.ResponseKind().(*kmsg.ProduceResponse)
+		resp.SetVersion(produce.GetVersion())
+
+		for _, rt := range produce.Topics {
+			st := kmsg.NewProduceResponseTopic()
+			st.Topic = rt.Topic
+			st.TopicID = rt.TopicID
+
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewProduceResponseTopicPartition()
+				sp.Partition = rp.Partition
+				sp.ErrorCode = kerr.InvalidRecord.Code
+				st.Partitions = append(st.Partitions, sp)
+			}
+
+			resp.Topics = append(resp.Topics, st)
+		}
+
+		return resp, nil, true
+	})
+
+	var produceErr error
+	done := make(chan struct{})
+	client.ProduceCallback(&kgo.Record{Topic: "bookings", Value: []byte("a")}, func(_ kafka.Record, err error) {
+		produceErr = err
+		close(done)
+	})
+	<-done
+
+	if produceErr == nil {
+		t.Fatal("got no produce error")
+	}
+
+	if got := sampleCount(t, reg, "test_kafka_produce_errors_total", bookingLabels); got != 1 {
+		t.Errorf("got %v produce errors, want 1", got)
+	}
+
+	if got := sampleCount(t, reg, "test_kafka_produce_latency_seconds", bookingLabels); got != 1 {
+		t.Errorf("got %v produce latencies, want 1", got)
+	}
+}
+
+func produce(t *testing.T, client *kafka.Client, r *kgo.Record) {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	client.ProduceCallback(r, func(_ kafka.Record, err error) {
+		errs <- err
+	})
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sampleCount returns the value of a counter or the sample count of a histogram with the given labels.
+func sampleCount(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			if !hasLabels(m, labels) {
+				continue
+			}
+
+			if m.GetHistogram() != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+
+			return m.GetCounter().GetValue()
+		}
+	}
+
+	return 0
+}
+
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	for _, pair := range m.GetLabel() {
+		if want, ok := labels[pair.GetName()]; ok && pair.GetValue() != want {
+			return false
+		}
+	}
+
+	return true
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(kafkatest.DefaultTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Middleware wraps a HandlerFunc of a consumer. A middleware may modify the record before calling next,
+// or drop it by not calling next at all.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// ProduceInterceptor is called for every record before it is produced. The context is the record context
+// or the client context if the record has none. Returning an error fails the record.
+type ProduceInterceptor func(ctx context.Context, r Record) error
+
+// wrap applies the middlewares of the client to the handler. Middlewares registered later wrap those registered
+// earlier, so consuming middlewares undo produce interceptors registered in the same order.
+// Trace context is extracted before any middleware runs.
+func (c *Client) wrap(h HandlerFunc) HandlerFunc {
+	h = c.metricsMiddleware(h)
+
+	for _, mw := range c.middlewares {
+		h = mw(h)
+	}
+
+	return c.traceMiddleware(h)
+}
+
+// recordContext returns the record context, or the client context if the record has none.
+func (c *Client) recordContext(r Record) context.Context {
+	if r.Context != nil {
+		return r.Context
+	}
+
+	return c.client.Context()
+}
+
+// recordErrorKey is the context key of the function receiving records a middleware failed to pass on.
+type recordErrorKey struct{}
+
+// fail reports a record that a middleware cannot pass to the handler. Pull-style consumers receive the record
+// with the error; otherwise the error is passed to the error handler.
+func (c *Client) fail(r Record, err error) {
+	if r.Context != nil {
+		if fn, ok := r.Context.Value(recordErrorKey{}).(func(Record, error)); ok {
+			fn(r, err)
+			return
+		}
+	}
+
+	c.onError(err)
+}
+
+// intercept runs all produce interceptors of the client on the record. It returns the producer span of the record,
+// which the caller ends once the record was produced.
+func (c *Client) intercept(r Record) (Span, error) {
+	ctx := c.recordContext(r)
+	span := c.injectTrace(ctx, r)
+
+	for _, fn := range c.interceptors {
+		if err := fn(ctx, r); err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+	}
+
+	return span, nil
+}
+
+// HeaderValue returns the value of the first header with the given key.
+func HeaderValue(r Record, key string) ([]byte, bool) {
+	for _, h := range r.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// SetHeader replaces all headers with the given key by a single header with the value.
+func SetHeader(r Record, key string, value []byte) {
+	DeleteHeader(r, key)
+	r.Headers = append(r.Headers, kgo.RecordHeader{Key: key, Value: value})
+}
+
+// DeleteHeader removes all headers with the given key.
+func DeleteHeader(r Record, key string) {
+	headers := r.Headers[:0]
+	for _, h := range r.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+
+	r.Headers = headers
+}
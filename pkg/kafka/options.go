@@ -2,9 +2,11 @@ package kafka
 
 import (
 	"context"
+	"errors"
 
 	"github.com/eliona-smart-building-assistant/backend-frm/pkg/log"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
 )
 
 type Opt func(*Client)
@@ -32,7 +34,15 @@ func WithClientID(id string) func(*Client) {
 
 func WithGroup(group string) func(*Client) {
 	return func(c *Client) {
-		c.opts = append(c.opts, kgo.ConsumerGroup(group))
+		c.group = group
+		c.opts = append(c.opts,
+			kgo.ConsumerGroup(group),
+			kgo.AutoCommitCallback(func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+				if err == nil {
+					c.markCommit()
+				}
+			}),
+		)
 	}
 }
 
@@ -73,3 +83,80 @@ func WithLogger(l log.Logger) Opt {
 		c.logger = l
 	}
 }
+
+// WithConsumeRateLimit limits handling of records of the topic to perSecond records with bursts of up to burst records.
+// Fetching of the topic is paused while the limit is exhausted. New fails if perSecond is not positive.
+func WithConsumeRateLimit(topic string, perSecond float64, burst int) Opt {
+	return func(c *Client) {
+		limiter, err := newRateLimiter(topic, perSecond, burst)
+		if err != nil {
+			c.optErr = errors.Join(c.optErr, err)
+			return
+		}
+
+		if c.consumeLimits == nil {
+			c.consumeLimits = make(map[string]*rateLimiter)
+		}
+
+		limiter.counters = c.countersFor(topic)
+		c.consumeLimits[topic] = limiter
+	}
+}
+
+// WithProduceRateLimit limits producing to the topic to perSecond records with bursts of up to burst records.
+// The mode defines whether exhausted limits block the caller or reject the record with a RateLimitError.
+// New fails if perSecond is not positive.
+func WithProduceRateLimit(topic string, perSecond float64, burst int, mode ThrottleMode) Opt {
+	return func(c *Client) {
+		limiter, err := newRateLimiter(topic, perSecond, burst)
+		if err != nil {
+			c.optErr = errors.Join(c.optErr, err)
+			return
+		}
+
+		if c.produceLimits == nil {
+			c.produceLimits = make(map[string]*rateLimiter)
+		}
+
+		limiter.mode = mode
+		limiter.counters = c.countersFor(topic)
+		c.produceLimits[topic] = limiter
+	}
+}
+
+// WithMiddleware adds middlewares wrapping every handler of the consumer, including functions passed to
+// PollRecords. Middlewares registered later wrap those registered earlier.
+func WithMiddleware(mw ...Middleware) Opt {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, mw...)
+	}
+}
+
+// WithProduceInterceptors adds interceptors that are called in order for every record before it is produced.
+func WithProduceInterceptors(fn ...ProduceInterceptor) Opt {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, fn...)
+	}
+}
+
+// WithTracer sets the tracer used to start producer and consumer spans. Defaults to a no-op tracer.
+func WithTracer(t Tracer) Opt {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+// WithPropagator sets the propagator writing and reading trace context headers. Defaults to TraceContext.
+func WithPropagator(p Propagator) Opt {
+	return func(c *Client) {
+		c.propagator = p
+	}
+}
+
+// WithMetrics reports produce latency, fetch sizes, broker errors, handler durations and throttling to m.
+func WithMetrics(m Metrics) Opt {
+	return func(c *Client) {
+		c.metrics = m
+		c.opts = append(c.opts, kgo.WithHooks(&metricsHooks{c: c}))
+	}
+}
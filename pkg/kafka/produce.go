@@ -1,16 +1,86 @@
 package kafka
 
-import "github.com/twmb/franz-go/pkg/kgo"
+import (
+	"context"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
 
 func (c *Client) Produce(r Record) {
-	c.client.Produce(c.client.Context(), r, nil)
+	if err := c.throttleProduce(r.Topic); err != nil {
+		c.onError(err)
+		return
+	}
+
+	span, err := c.intercept(r)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+
+	c.client.Produce(c.client.Context(), r, func(_ *kgo.Record, err error) {
+		endSpan(span, err)
+	})
 }
 
 func (c *Client) ProduceCallback(r Record, callback func(record Record, err error)) {
+	if err := c.throttleProduce(r.Topic); err != nil {
+		callback(r, err)
+		return
+	}
+
+	span, err := c.intercept(r)
+	if err != nil {
+		callback(r, err)
+		return
+	}
+
 	c.client.Produce(
 		c.client.Context(),
 		r,
 		func(r *kgo.Record, err error) {
+			endSpan(span, err)
 			callback(r, err)
 		})
 }
+
+// produceSync produces the records through throttling and produce interceptors and waits until the broker
+// acknowledged them. Records failing throttling or an interceptor are not produced and returned with the error.
+func (c *Client) produceSync(ctx context.Context, records ...*kgo.Record) kgo.ProduceResults {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(kgo.ProduceResults, 0, len(records))
+	)
+
+	done := func(r *kgo.Record, err error) {
+		mu.Lock()
+		results = append(results, kgo.ProduceResult{Record: r, Err: err})
+		mu.Unlock()
+	}
+
+	for _, r := range records {
+		if err := c.throttleProduce(r.Topic); err != nil {
+			done(r, err)
+			continue
+		}
+
+		span, err := c.intercept(r)
+		if err != nil {
+			done(r, err)
+			continue
+		}
+
+		wg.Add(1)
+		c.client.Produce(ctx, r, func(r *kgo.Record, err error) {
+			defer wg.Done()
+			endSpan(span, err)
+			done(r, err)
+		})
+	}
+
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,93 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// recordingTracer records the spans it started.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, _ string, _ kafka.SpanKind) (context.Context, kafka.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	span := &recordingSpan{}
+	t.spans = append(t.spans, span)
+
+	return ctx, span
+}
+
+type recordingSpan struct {
+	mu    sync.Mutex
+	err   error
+	ended bool
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+}
+
+func (s *recordingSpan) state() (error, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err, s.ended
+}
+
+func TestProduceSpan(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "bookings")
+
+	errRejected := errors.New("rejected")
+	tracer := &recordingTracer{}
+	client := cluster.NewClient(
+		kafka.WithTracer(tracer),
+		kafka.WithProduceInterceptors(func(_ context.Context, r kafka.Record) error {
+			if string(r.Value) == "invalid" {
+				return errRejected
+			}
+
+			return nil
+		}),
+	)
+
+	tests := []struct {
+		value   string
+		wantErr error
+	}{
+		{"valid", nil},
+		{"invalid", errRejected},
+	}
+
+	for i, tt := range tests {
+		done := make(chan struct{})
+		client.ProduceCallback(&kgo.Record{Topic: "bookings", Value: []byte(tt.value)}, func(kafka.Record, error) {
+			defer close(done)
+
+			// The span ends before the callback is called, once the record was produced or rejected.
+			if err, ended := tracer.spans[i].state(); !ended || !errors.Is(err, tt.wantErr) {
+				t.Errorf("got span ended %t with error %v for %s, want ended with %v", ended, err, tt.value, tt.wantErr)
+			}
+		})
+		<-done
+	}
+}
@@ -0,0 +1,244 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ThrottleMode defines how Produce and ProduceCallback behave when the rate limit of a topic is exhausted.
+type ThrottleMode int
+
+const (
+	// ThrottleBlock blocks the caller until a token is available.
+	ThrottleBlock ThrottleMode = iota
+	// ThrottleReject fails the record immediately with a RateLimitError.
+	ThrottleReject
+)
+
+// RateLimitError is returned for records rejected by a produce rate limit in ThrottleReject mode.
+type RateLimitError struct {
+	Topic      string
+	RetryAfter time.Duration
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for topic %q, retry after %s", e.Topic, e.RetryAfter)
+}
+
+// ThrottleStats holds accumulated throttling metrics of a single topic.
+type ThrottleStats struct {
+	ConsumeThrottled time.Duration `json:"consume_throttled"`
+	ProduceThrottled time.Duration `json:"produce_throttled"`
+	ProduceRejected  int64         `json:"produce_rejected"`
+}
+
+type throttleCounters struct {
+	consumeThrottled atomic.Int64
+	produceThrottled atomic.Int64
+	produceRejected  atomic.Int64
+}
+
+type rateLimiter struct {
+	bucket   *tokenBucket
+	mode     ThrottleMode
+	counters *throttleCounters
+
+	// pauseMu guards the number of throttled handlers and whether fetching was paused for them.
+	pauseMu sync.Mutex
+	waiting int
+	paused  bool
+}
+
+// tokenBucket is a classic token bucket refilled continuously at rate tokens per second up to burst tokens.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(topic string, perSecond float64, burst int) (*rateLimiter, error) {
+	if perSecond <= 0 {
+		return nil, fmt.Errorf("rate limit of topic %q: got %v records per second, want more than 0", topic, perSecond)
+	}
+
+	return &rateLimiter{bucket: newTokenBucket(perSecond, burst)}, nil
+}
+
+func newTokenBucket(perSecond float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	b.last = now
+}
+
+// reserve takes a token, going into debt if none is available, and returns how long the caller has to wait
+// before the token may be used.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// allow takes a token if one is available. Otherwise, it returns the time until the next token is available.
+func (b *tokenBucket) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// ThrottleStats returns throttling metrics per topic for all topics with a rate limit.
+func (c *Client) ThrottleStats() map[string]ThrottleStats {
+	stats := make(map[string]ThrottleStats)
+
+	for topic, counters := range c.throttleCounters {
+		stats[topic] = ThrottleStats{
+			ConsumeThrottled: time.Duration(counters.consumeThrottled.Load()),
+			ProduceThrottled: time.Duration(counters.produceThrottled.Load()),
+			ProduceRejected:  counters.produceRejected.Load(),
+		}
+	}
+
+	return stats
+}
+
+func (c *Client) countersFor(topic string) *throttleCounters {
+	if c.throttleCounters == nil {
+		c.throttleCounters = make(map[string]*throttleCounters)
+	}
+
+	counters, ok := c.throttleCounters[topic]
+	if !ok {
+		counters = &throttleCounters{}
+		c.throttleCounters[topic] = counters
+	}
+
+	return counters
+}
+
+// throttleConsume blocks until the consume rate limit of the topic allows to handle one more record.
+// Fetching of the topic is paused while waiting, so the client does not buffer records it cannot handle yet.
+func (c *Client) throttleConsume(ctx context.Context, topic string) {
+	limiter, ok := c.consumeLimits[topic]
+	if !ok {
+		return
+	}
+
+	wait := limiter.bucket.reserve(time.Now())
+	if wait <= 0 {
+		return
+	}
+
+	defer c.pauseThrottled(limiter, topic)()
+
+	started := time.Now()
+	c.sleep(ctx, wait)
+	throttled := time.Since(started)
+	limiter.counters.consumeThrottled.Add(int64(throttled))
+	c.metrics.ObserveThrottle(c.labels(topic, -1), ThrottleDirectionConsume, throttled)
+}
+
+// pauseThrottled pauses fetching of the topic while handlers wait for its rate limit and returns a function
+// to call once a handler is done waiting. The last one resumes the topic, unless it was already paused before
+// the rate limit paused it.
+func (c *Client) pauseThrottled(limiter *rateLimiter, topic string) func() {
+	limiter.pauseMu.Lock()
+	defer limiter.pauseMu.Unlock()
+
+	if limiter.waiting == 0 {
+		limiter.paused = !slices.Contains(c.client.PauseFetchTopics(), topic)
+		if limiter.paused {
+			c.client.PauseFetchTopics(topic)
+		}
+	}
+
+	limiter.waiting++
+
+	return func() {
+		limiter.pauseMu.Lock()
+		defer limiter.pauseMu.Unlock()
+
+		limiter.waiting--
+		if limiter.waiting == 0 && limiter.paused {
+			c.client.ResumeFetchTopics(topic)
+		}
+	}
+}
+
+// throttleProduce applies the produce rate limit of the topic. In ThrottleReject mode it returns a
+// RateLimitError if no token is available, otherwise it blocks until the record may be produced.
+func (c *Client) throttleProduce(topic string) error {
+	limiter, ok := c.produceLimits[topic]
+	if !ok {
+		return nil
+	}
+
+	if limiter.mode == ThrottleReject {
+		allowed, retryAfter := limiter.bucket.allow(time.Now())
+		if !allowed {
+			limiter.counters.produceRejected.Add(1)
+			return RateLimitError{Topic: topic, RetryAfter: retryAfter}
+		}
+
+		return nil
+	}
+
+	wait := limiter.bucket.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	started := time.Now()
+	c.sleep(c.client.Context(), wait)
+	throttled := time.Since(started)
+	limiter.counters.produceThrottled.Add(int64(throttled))
+	c.metrics.ObserveThrottle(c.labels(topic, -1), ThrottleDirectionProduce, throttled)
+
+	return nil
+}
+
+// sleep waits for the given duration unless the context is done or the client is shut down.
+func (c *Client) sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-c.shutdown:
+	}
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if wait := b.reserve(now); wait != 0 {
+			t.Fatalf("reserve %d: got wait %s, want 0", i, wait)
+		}
+	}
+
+	if wait := b.reserve(now); wait != 100*time.Millisecond {
+		t.Errorf("got wait %s, want %s", wait, 100*time.Millisecond)
+	}
+
+	if wait := b.reserve(now.Add(100 * time.Millisecond)); wait != 100*time.Millisecond {
+		t.Errorf("got wait %s after refill, want %s", wait, 100*time.Millisecond)
+	}
+}
+
+func TestTokenBucketAllow(t *testing.T) {
+	b := newTokenBucket(4, 1)
+	now := time.Now()
+
+	if ok, _ := b.allow(now); !ok {
+		t.Fatal("first token rejected")
+	}
+
+	ok, retryAfter := b.allow(now)
+	if ok {
+		t.Fatal("token allowed from an empty bucket")
+	}
+
+	if retryAfter != 250*time.Millisecond {
+		t.Errorf("got retry after %s, want %s", retryAfter, 250*time.Millisecond)
+	}
+
+	if ok, _ := b.allow(now.Add(250 * time.Millisecond)); !ok {
+		t.Error("token rejected after refill")
+	}
+}
+
+func TestRateLimitRejectsInvalidRate(t *testing.T) {
+	opts := []Opt{
+		WithConsumeRateLimit("bookings", 0, 1),
+		WithProduceRateLimit("bookings", -1, 1, ThrottleBlock),
+	}
+
+	for _, opt := range opts {
+		if _, err := New(opt); err == nil {
+			t.Error("got no error for a rate limit of 0 records per second")
+		}
+	}
+}
+
+func TestThrottleConsumeKeepsPausedTopics(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(1, "bookings", "occupancy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	client, err := New(
+		Seeds(cluster.ListenAddrs()...),
+		WithConsumeRateLimit("bookings", 100, 1),
+		WithConsumeRateLimit("occupancy", 100, 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	client.client.PauseFetchTopics("occupancy")
+
+	ctx := context.Background()
+	for _, topic := range []string{"bookings", "occupancy"} {
+		// The second record has to wait for the rate limit.
+		client.throttleConsume(ctx, topic)
+		client.throttleConsume(ctx, topic)
+	}
+
+	paused := client.client.PauseFetchTopics()
+	if slices.Contains(paused, "bookings") || !slices.Contains(paused, "occupancy") {
+		t.Errorf("got paused topics %v after throttling, want [occupancy]", paused)
+	}
+}
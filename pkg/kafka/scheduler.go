@@ -0,0 +1,302 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/log"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	defaultSchedulerTable        = "kafka_scheduled_records"
+	defaultSchedulerPollInterval = 1 * time.Second
+	defaultSchedulerBatchSize    = 100
+	defaultSchedulerRetryDelay   = 1 * time.Minute
+)
+
+// Scheduler delays delivery of records until a given point in time.
+//
+// Scheduled records are parked in a Postgres table, so they survive restarts. Any number of instances can run
+// the same scheduler: due records are locked with SKIP LOCKED while they are published, so every record is
+// released by one instance only. A record is deleted in the same transaction after the broker acknowledged it,
+// so a crash between both steps can publish it again (at-least-once). Records the broker rejects are reported to
+// the error handler and parked until the retry delay elapsed; their attempts and last error are kept in the table.
+type Scheduler struct {
+	client       *Client
+	pool         *postgres.Pool
+	logger       log.Logger
+	table        string
+	pollInterval time.Duration
+	batchSize    int
+	retryDelay   time.Duration
+}
+
+type SchedulerOpt func(*Scheduler)
+
+// WithSchedulerTable sets the table holding scheduled records. Defaults to kafka_scheduled_records.
+func WithSchedulerTable(table string) SchedulerOpt {
+	return func(s *Scheduler) {
+		s.table = table
+	}
+}
+
+// WithSchedulerPollInterval sets how often the table is checked for due records. Defaults to 1 second.
+func WithSchedulerPollInterval(d time.Duration) SchedulerOpt {
+	return func(s *Scheduler) {
+		s.pollInterval = d
+	}
+}
+
+// WithSchedulerBatchSize sets how many due records are released in a single transaction. Defaults to 100.
+func WithSchedulerBatchSize(n int) SchedulerOpt {
+	return func(s *Scheduler) {
+		s.batchSize = n
+	}
+}
+
+// WithSchedulerRetryDelay sets how long a record that failed to publish is parked before it is retried.
+// Defaults to 1 minute.
+func WithSchedulerRetryDelay(d time.Duration) SchedulerOpt {
+	return func(s *Scheduler) {
+		s.retryDelay = d
+	}
+}
+
+// NewScheduler returns a scheduler publishing due records with the client. Released records pass through
+// throttling and the produce interceptors of the client like records passed to Produce.
+func (c *Client) NewScheduler(pool *postgres.Pool, opts ...SchedulerOpt) *Scheduler {
+	logger := c.logger.With().Str("component", "scheduler").Logger()
+
+	s := &Scheduler{
+		client:       c,
+		pool:         pool,
+		logger:       &logger,
+		table:        defaultSchedulerTable,
+		pollInterval: defaultSchedulerPollInterval,
+		batchSize:    defaultSchedulerBatchSize,
+		retryDelay:   defaultSchedulerRetryDelay,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Init creates the table for scheduled records if it does not exist yet.
+func (s *Scheduler) Init(ctx context.Context) error {
+	table := postgres.SanitizedIdentifier(s.table)
+	index := postgres.SanitizedIdentifier(s.table + "_deliver_at_idx")
+
+	_, err := s.pool.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id            bigserial PRIMARY KEY,
+			deliver_at    timestamptz NOT NULL,
+			topic         text        NOT NULL,
+			key           bytea,
+			value         bytea,
+			header_keys   text[]      NOT NULL DEFAULT '{}',
+			header_values bytea[]     NOT NULL DEFAULT '{}',
+			created_at    timestamptz NOT NULL DEFAULT now(),
+			attempts      int         NOT NULL DEFAULT 0,
+			last_error    text
+		);
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS attempts int NOT NULL DEFAULT 0;
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS last_error text;
+		CREATE INDEX IF NOT EXISTS %s ON %s (deliver_at);`,
+		table, table, table, index, table,
+	))
+
+	return err
+}
+
+// Schedule parks the record until deliverAt. The record is published to its topic once it is due.
+func (s *Scheduler) Schedule(ctx context.Context, r Record, deliverAt time.Time) error {
+	return s.ScheduleWith(ctx, s.pool, r, deliverAt)
+}
+
+// ScheduleWith is like Schedule, but stores the record using the given Execer. Pass a transaction to
+// schedule the record atomically with other changes.
+func (s *Scheduler) ScheduleWith(ctx context.Context, e postgres.Execer, r Record, deliverAt time.Time) error {
+	if r.Topic == "" {
+		return errors.New("scheduler: record has no topic")
+	}
+
+	// Interceptors run when the record is released, without the context of the caller. The tenant is kept in
+	// the header, so the record is produced for the tenant of the context.
+	if tenantID, ok := TenantFromContext(ctx); ok && s.client.tenancy != nil {
+		if _, ok := HeaderValue(r, HeaderTenantID); !ok {
+			SetHeader(r, HeaderTenantID, []byte(tenantID))
+		}
+	}
+
+	headerKeys := make([]string, len(r.Headers))
+	headerValues := make([][]byte, len(r.Headers))
+	for i, h := range r.Headers {
+		headerKeys[i] = h.Key
+		headerValues[i] = h.Value
+	}
+
+	_, err := e.Exec(ctx,
+		fmt.Sprintf(`INSERT INTO %s (deliver_at, topic, key, value, header_keys, header_values)
+			VALUES ($1, $2, $3, $4, $5, $6)`, postgres.SanitizedIdentifier(s.table)),
+		deliverAt, r.Topic, r.Key, r.Value, headerKeys, headerValues,
+	)
+	if err != nil {
+		return fmt.Errorf("scheduler: schedule record: %w", err)
+	}
+
+	return nil
+}
+
+// Run releases due records until the context is canceled or the client is closed.
+// Errors are reported to the error handler of the client and do not stop the scheduler.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			released, err := s.release(ctx)
+			if err != nil {
+				s.client.onError(err)
+				break
+			}
+
+			if released > 0 {
+				s.logger.Debug().Int("records", released).Msg("released scheduled records")
+			}
+
+			if released < s.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.client.shutdown:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) release(ctx context.Context) (int, error) {
+	tx, err := s.pool.Tx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("scheduler: begin: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	table := postgres.SanitizedIdentifier(s.table)
+
+	rows, err := tx.Query(ctx,
+		fmt.Sprintf(`SELECT id, topic, key, value, header_keys, header_values FROM %s
+			WHERE deliver_at <= now()
+			ORDER BY deliver_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED`, table),
+		s.batchSize,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("scheduler: select due records: %w", err)
+	}
+
+	var (
+		ids     = make(map[*kgo.Record]int64)
+		records []*kgo.Record
+	)
+
+	for rows.Next() {
+		var (
+			id           int64
+			r            = &kgo.Record{}
+			headerKeys   []string
+			headerValues [][]byte
+		)
+
+		if err := rows.Scan(&id, &r.Topic, &r.Key, &r.Value, &headerKeys, &headerValues); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scheduler: scan record: %w", err)
+		}
+
+		for i := range headerKeys {
+			r.Headers = append(r.Headers, kgo.RecordHeader{Key: headerKeys[i], Value: headerValues[i]})
+		}
+
+		ids[r] = id
+		records = append(records, r)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("scheduler: read due records: %w", err)
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	released, failed := splitResults(ids, s.client.produceSync(ctx, records...))
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ANY($1)`, table), released)
+	if err != nil {
+		return 0, fmt.Errorf("scheduler: delete released records: %w", err)
+	}
+
+	for _, f := range failed {
+		_, err = tx.Exec(ctx,
+			fmt.Sprintf(`UPDATE %s SET attempts = attempts + 1, last_error = $2, deliver_at = now() + $3::interval WHERE id = $1`, table),
+			f.id, f.err.Error(), s.retryDelay,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("scheduler: park failed record %d: %w", f.id, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("scheduler: commit: %w", err)
+	}
+
+	for _, f := range failed {
+		s.client.onError(fmt.Errorf("scheduler: publish record %d to %q, retry in %s: %w", f.id, f.topic, s.retryDelay, f.err))
+	}
+
+	return len(released), nil
+}
+
+type failedRecord struct {
+	id    int64
+	topic string
+	err   error
+}
+
+// splitResults returns the IDs of the records the broker acknowledged and the records that failed.
+func splitResults(ids map[*kgo.Record]int64, results kgo.ProduceResults) ([]int64, []failedRecord) {
+	var (
+		released []int64
+		failed   []failedRecord
+	)
+
+	for _, res := range results {
+		id := ids[res.Record]
+		if res.Err != nil {
+			failed = append(failed, failedRecord{id: id, topic: res.Record.Topic, err: res.Err})
+			continue
+		}
+
+		released = append(released, id)
+	}
+
+	return released, failed
+}
@@ -0,0 +1,127 @@
+package kafka_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+)
+
+func TestSchedulerParksFailedRecords(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "reminders")
+
+	var reported []error
+	client := cluster.NewClient(kafka.WithOnError(func(err error) {
+		reported = append(reported, err)
+	}))
+
+	table := "kafka_scheduled_records_test"
+	_, _ = pool.Exec(ctx, "DROP TABLE IF EXISTS "+table)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), "DROP TABLE IF EXISTS "+table)
+	})
+
+	scheduler := client.NewScheduler(pool, kafka.WithSchedulerTable(table), kafka.WithSchedulerRetryDelay(time.Hour))
+	if err := scheduler.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Now().Add(-time.Second)
+
+	valid := kafka.NewRecord()
+	valid.Topic = "reminders"
+	valid.Value = []byte("due")
+
+	// Records larger than the maximum batch size are rejected by the producer.
+	tooLarge := kafka.NewRecord()
+	tooLarge.Topic = "reminders"
+	tooLarge.Value = bytes.Repeat([]byte("x"), 2<<20)
+
+	for _, r := range []kafka.Record{valid, tooLarge} {
+		if err := scheduler.Schedule(ctx, r, due); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	_ = scheduler.Run(runCtx)
+
+	if records := cluster.ConsumeAll("reminders"); len(records) != 1 || string(records[0].Value) != "due" {
+		t.Errorf("got %d published records, want the valid one", len(records))
+	}
+
+	parked, err := postgres.CollectColumn[int](ctx, pool, "SELECT attempts FROM "+table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parked) != 1 || parked[0] != 1 {
+		t.Errorf("got attempts %v of remaining records, want [1]", parked)
+	}
+
+	if len(reported) != 1 {
+		t.Errorf("got errors %v, want one for the rejected record", reported)
+	}
+}
+
+func TestSchedulerProducesThroughInterceptors(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "reminders")
+
+	client := cluster.NewClient(
+		kafka.WithTenancy(),
+		kafka.WithProduceInterceptors(func(_ context.Context, r kafka.Record) error {
+			kafka.SetHeader(r, "intercepted", []byte("true"))
+			return nil
+		}),
+	)
+
+	table := "kafka_scheduled_records_interceptors_test"
+	_, _ = pool.Exec(ctx, "DROP TABLE IF EXISTS "+table)
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), "DROP TABLE IF EXISTS "+table)
+	})
+
+	scheduler := client.NewScheduler(pool, kafka.WithSchedulerTable(table))
+	if err := scheduler.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	r := kafka.NewRecord()
+	r.Topic = "reminders"
+	r.Value = []byte("due")
+
+	// The tenant of the context is kept until the record is released.
+	if err := scheduler.Schedule(kafka.ContextWithTenant(ctx, "t1"), r, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+
+	_ = scheduler.Run(runCtx)
+
+	records := cluster.ConsumeAll("reminders")
+	if len(records) != 1 {
+		t.Fatalf("got %d published records, want 1", len(records))
+	}
+
+	tenant, _ := kafka.HeaderValue(records[0], kafka.HeaderTenantID)
+	intercepted, _ := kafka.HeaderValue(records[0], "intercepted")
+	if string(tenant) != "t1" || string(intercepted) != "true" {
+		t.Errorf("got tenant %q and intercepted %q, want t1 and true", tenant, intercepted)
+	}
+}
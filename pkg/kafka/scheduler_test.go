@@ -0,0 +1,27 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestSplitResults(t *testing.T) {
+	ok := &kgo.Record{Topic: "reminders"}
+	rejected := &kgo.Record{Topic: "reminders"}
+	ids := map[*kgo.Record]int64{ok: 1, rejected: 2}
+
+	released, failed := splitResults(ids, kgo.ProduceResults{
+		{Record: rejected, Err: kgo.ErrRecordTimeout},
+		{Record: ok},
+	})
+
+	if len(released) != 1 || released[0] != 1 {
+		t.Errorf("got released %v, want [1]", released)
+	}
+
+	if len(failed) != 1 || failed[0].id != 2 || !errors.Is(failed[0].err, kgo.ErrRecordTimeout) {
+		t.Errorf("got failed %+v, want record 2", failed)
+	}
+}
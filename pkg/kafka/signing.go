@@ -0,0 +1,303 @@
+package kafka
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	// HeaderSignature holds the signature of a signed record.
+	HeaderSignature = "sig"
+	// HeaderSignatureKeyID holds the ID of the key that signed the record.
+	HeaderSignatureKeyID = "sig-key-id"
+	// HeaderDeadLetterReason holds the reason why a record was moved to a dead-letter topic.
+	HeaderDeadLetterReason = "dlq-reason"
+)
+
+var (
+	ErrUnsigned         = errors.New("record is not signed")
+	ErrInvalidSignature = errors.New("invalid record signature")
+)
+
+// PublicKeyResolver returns the public key for a key ID stored in the signature header,
+// e.g. keyvault.Client.ResolvePublicKey.
+type PublicKeyResolver func(ctx context.Context, keyID string) (crypto.PublicKey, error)
+
+type SignatureOpt func(*signatureConfig)
+
+type signatureConfig struct {
+	headers         []string
+	topics          map[string]struct{}
+	deadLetterTopic string
+}
+
+// WithSignedHeaders adds the given headers to the signed content. Signer and verifier must use the same headers.
+func WithSignedHeaders(headers ...string) SignatureOpt {
+	return func(cfg *signatureConfig) {
+		cfg.headers = append(cfg.headers, headers...)
+	}
+}
+
+// WithSignedTopics restricts signing and verification to the given topics. By default, all topics are affected.
+func WithSignedTopics(topics ...string) SignatureOpt {
+	return func(cfg *signatureConfig) {
+		if cfg.topics == nil {
+			cfg.topics = make(map[string]struct{})
+		}
+
+		for _, t := range topics {
+			cfg.topics[t] = struct{}{}
+		}
+	}
+}
+
+// WithSignatureDeadLetterTopic moves records failing verification to the given topic instead of dropping them.
+func WithSignatureDeadLetterTopic(topic string) SignatureOpt {
+	return func(cfg *signatureConfig) {
+		cfg.deadLetterTopic = topic
+	}
+}
+
+func newSignatureConfig(opts []SignatureOpt) *signatureConfig {
+	cfg := &signatureConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+func (cfg *signatureConfig) applies(topic string) bool {
+	if cfg.topics == nil {
+		return true
+	}
+
+	_, ok := cfg.topics[topic]
+
+	return ok
+}
+
+// WithSigning signs the topic, key, value and configured headers of produced records with the signer, e.g. one
+// obtained from keyvault.Client.GetSigner. The signature and keyID are stored in the record headers.
+// If keyID is empty, the key ID of the signer is used if it provides a KeyID method.
+//
+// Register WithSigning after other codecs, so the signature covers the record as it is written to the broker.
+func WithSigning(signer crypto.Signer, keyID string, opts ...SignatureOpt) Opt {
+	if keyID == "" {
+		if s, ok := signer.(interface{ KeyID() string }); ok {
+			keyID = s.KeyID()
+		}
+	}
+
+	cfg := newSignatureConfig(opts)
+
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, func(_ context.Context, r Record) error {
+			if !cfg.applies(r.Topic) {
+				return nil
+			}
+
+			DeleteHeader(r, HeaderSignature)
+			SetHeader(r, HeaderSignatureKeyID, []byte(keyID))
+
+			signature, err := signRecord(signer, cfg.headers, r)
+			if err != nil {
+				return fmt.Errorf("signing: %w", err)
+			}
+
+			SetHeader(r, HeaderSignature, signature)
+
+			return nil
+		})
+	}
+}
+
+// WithSignatureVerification verifies signatures of consumed records against public keys returned by the resolver.
+// Unsigned or tampered records are not passed to the handler. Pull-style consumers receive them with the error,
+// otherwise the error is reported to the error handler. They are also moved to a dead-letter topic if configured.
+//
+// Register WithSignatureVerification after other codecs, so it runs first on consumed records.
+func WithSignatureVerification(resolver PublicKeyResolver, opts ...SignatureOpt) Opt {
+	cfg := newSignatureConfig(opts)
+	keys := &sync.Map{}
+
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, func(next HandlerFunc) HandlerFunc {
+			return func(r Record) {
+				if !cfg.applies(r.Topic) {
+					next(r)
+					return
+				}
+
+				if err := verifyRecord(c.recordContext(r), resolver, keys, cfg.headers, r); err != nil {
+					c.fail(r, fmt.Errorf("verify %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+					if cfg.deadLetterTopic != "" {
+						c.deadLetter(r, cfg.deadLetterTopic, err)
+					}
+
+					return
+				}
+
+				next(r)
+			}
+		})
+	}
+}
+
+// deadLetter produces a copy of the record to the dead-letter topic, bypassing produce interceptors.
+func (c *Client) deadLetter(r Record, topic string, reason error) {
+	c.client.Produce(c.client.Context(), deadLetterRecord(r, topic, reason), func(_ *kgo.Record, err error) {
+		if err != nil {
+			c.onError(fmt.Errorf("dead letter to %q: %w", topic, err))
+		}
+	})
+}
+
+// deadLetterRecord returns a copy of the record for the dead-letter topic with the reason in a header.
+func deadLetterRecord(r Record, topic string, reason error) *kgo.Record {
+	headers := make([]kgo.RecordHeader, len(r.Headers), len(r.Headers)+1)
+	copy(headers, r.Headers)
+
+	return &kgo.Record{
+		Topic:   topic,
+		Key:     r.Key,
+		Value:   r.Value,
+		Headers: append(headers, kgo.RecordHeader{Key: HeaderDeadLetterReason, Value: []byte(reason.Error())}),
+	}
+}
+
+func signRecord(signer crypto.Signer, headers []string, r Record) ([]byte, error) {
+	h, opts, err := hashFor(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	writeSignedContent(h, headers, r)
+
+	return signer.Sign(rand.Reader, h.Sum(nil), opts)
+}
+
+func verifyRecord(ctx context.Context, resolver PublicKeyResolver, keys *sync.Map, headers []string, r Record) error {
+	signature, ok := HeaderValue(r, HeaderSignature)
+	if !ok {
+		return ErrUnsigned
+	}
+
+	keyID, _ := HeaderValue(r, HeaderSignatureKeyID)
+
+	pub, err := resolvePublicKey(ctx, resolver, keys, string(keyID))
+	if err != nil {
+		return fmt.Errorf("resolve key %q: %w", keyID, err)
+	}
+
+	h, opts, err := hashFor(pub)
+	if err != nil {
+		return err
+	}
+
+	writeSignedContent(h, headers, r)
+	digest := h.Sum(nil)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, opts.HashFunc(), digest, signature)
+	case *ecdsa.PublicKey:
+		if !verifyECDSA(pub, digest, signature) {
+			err = ErrInvalidSignature
+		}
+	}
+
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// verifyECDSA verifies raw R||S signatures as returned by Key Vault as well as ASN.1 encoded signatures
+// as returned by ecdsa.PrivateKey.Sign.
+func verifyECDSA(pub *ecdsa.PublicKey, digest []byte, signature []byte) bool {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	if len(signature) == 2*size {
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if ecdsa.Verify(pub, digest, r, s) {
+			return true
+		}
+	}
+
+	return ecdsa.VerifyASN1(pub, digest, signature)
+}
+
+func resolvePublicKey(ctx context.Context, resolver PublicKeyResolver, keys *sync.Map, keyID string) (crypto.PublicKey, error) {
+	if pub, ok := keys.Load(keyID); ok {
+		return pub, nil
+	}
+
+	pub, err := resolver(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys.Store(keyID, pub)
+
+	return pub, nil
+}
+
+// hashFor returns the hash matching the key type, following the algorithms supported by Key Vault.
+func hashFor(pub crypto.PublicKey) (hash.Hash, crypto.SignerOpts, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return crypto.SHA256.New(), crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return crypto.SHA256.New(), crypto.SHA256, nil
+		case elliptic.P384():
+			return crypto.SHA384.New(), crypto.SHA384, nil
+		case elliptic.P521():
+			return crypto.SHA512.New(), crypto.SHA512, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// writeSignedContent writes the topic, key ID, key, value and given headers length-prefixed to the hash,
+// so that no two different records produce the same content and records cannot be replayed to other topics.
+func writeSignedContent(h hash.Hash, headers []string, r Record) {
+	write := func(b []byte, present bool) {
+		var prefix [5]byte
+		if present {
+			prefix[0] = 1
+		}
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+		h.Write(prefix[:])
+		h.Write(b)
+	}
+
+	write([]byte(r.Topic), true)
+
+	keyID, ok := HeaderValue(r, HeaderSignatureKeyID)
+	write(keyID, ok)
+	write(r.Key, r.Key != nil)
+	write(r.Value, r.Value != nil)
+
+	for _, name := range headers {
+		value, ok := HeaderValue(r, name)
+		write([]byte(name), true)
+		write(value, ok)
+	}
+}
@@ -0,0 +1,130 @@
+package kafka
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestSignAndVerifyRecord(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := func(_ context.Context, keyID string) (crypto.PublicKey, error) {
+		if keyID != "cmd-key/1" {
+			return nil, errors.New("unknown key")
+		}
+		return key.Public(), nil
+	}
+
+	sign := func() Record {
+		r := &kgo.Record{
+			Topic:   "commands",
+			Key:     []byte("ahu-1"),
+			Value:   []byte(`{"setpoint":21}`),
+			Headers: []kgo.RecordHeader{{Key: "tenant_id", Value: []byte("t1")}},
+		}
+
+		SetHeader(r, HeaderSignatureKeyID, []byte("cmd-key/1"))
+		signature, err := signRecord(key, []string{"tenant_id"}, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetHeader(r, HeaderSignature, signature)
+
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(r Record)
+		wantErr error
+	}{
+		{"valid", func(Record) {}, nil},
+		{"value changed", func(r Record) { r.Value = []byte(`{"setpoint":35}`) }, ErrInvalidSignature},
+		{"signed header changed", func(r Record) { SetHeader(r, "tenant_id", []byte("t2")) }, ErrInvalidSignature},
+		{"replayed to other topic", func(r Record) { r.Topic = "setpoints" }, ErrInvalidSignature},
+		{"unsigned", func(r Record) { DeleteHeader(r, HeaderSignature) }, ErrUnsigned},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := sign()
+			tt.tamper(r)
+
+			err := verifyRecord(ctx, resolver, &sync.Map{}, []string{"tenant_id"}, r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// rawSigner returns raw R||S signatures like Key Vault does for EC keys.
+type rawSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s rawSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s rawSigner) Sign(rand io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	r, sig, err := ecdsa.Sign(rand, s.key, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (s.key.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	r.FillBytes(raw[:size])
+	sig.FillBytes(raw[size:])
+
+	return raw, nil
+}
+
+func TestVerifyRawSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := func(context.Context, string) (crypto.PublicKey, error) {
+		return key.Public(), nil
+	}
+
+	r := &kgo.Record{Topic: "commands", Value: []byte(`{"setpoint":21}`)}
+	SetHeader(r, HeaderSignatureKeyID, []byte("cmd-key/1"))
+
+	signature, err := signRecord(rawSigner{key: key}, nil, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(signature) != 96 {
+		t.Fatalf("got signature of %d bytes, want raw P-384 signature of 96 bytes", len(signature))
+	}
+
+	SetHeader(r, HeaderSignature, signature)
+
+	if err := verifyRecord(context.Background(), resolver, &sync.Map{}, nil, r); err != nil {
+		t.Errorf("got error %v for raw signature", err)
+	}
+
+	signature[0] ^= 0xff
+	if err := verifyRecord(context.Background(), resolver, &sync.Map{}, nil, r); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got error %v for tampered raw signature, want %v", err, ErrInvalidSignature)
+	}
+}
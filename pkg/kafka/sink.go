@@ -0,0 +1,522 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/log"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	defaultSinkBatchSize     = 1000
+	defaultSinkFlushInterval = 1 * time.Second
+	minSinkRetryDelay        = 100 * time.Millisecond
+	maxSinkRetryDelay        = 10 * time.Second
+
+	// maxQueryParams is the maximum number of parameters of a single Postgres statement.
+	maxQueryParams = 65535
+)
+
+// SinkMapper maps a record to a row with one value per sink column. Returning a nil row skips the record,
+// returning an error makes it a poison record.
+type SinkMapper func(r Record) ([]any, error)
+
+// PoisonPolicy decides what happens with records that cannot be mapped or written.
+type PoisonPolicy int
+
+const (
+	// PoisonStop stops the sink with a PoisonRecordError. The batch is not committed.
+	PoisonStop PoisonPolicy = iota
+	// PoisonSkip reports the record to the error handler and skips it.
+	PoisonSkip
+	// PoisonDeadLetter produces the record to the dead letter topic and skips it.
+	PoisonDeadLetter
+)
+
+type conflictAction int
+
+const (
+	conflictFail conflictAction = iota
+	conflictUpdate
+	conflictIgnore
+)
+
+// PoisonRecordError is returned by Sink.Run for poison records with the PoisonStop policy.
+type PoisonRecordError struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+func (e *PoisonRecordError) Error() string {
+	return fmt.Sprintf("sink: poison record %s/%d@%d: %s", e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+func (e *PoisonRecordError) Unwrap() error {
+	return e.Err
+}
+
+// Sink writes consumed records to a Postgres table.
+//
+// Records are collected into batches that are flushed when they are full or the flush interval elapsed since the
+// first record of the batch. Every batch is written in a single transaction, either with COPY (default) or a
+// multi-row upsert. Offsets are committed only after the transaction committed, so records are written at least
+// once; use an upsert to make redelivery idempotent.
+//
+// If a batch fails with a data or constraint error, its records are written one by one to find the poison records,
+// which are handled according to the poison policy. Other errors, e.g. lost connections, are reported to the error
+// handler and the batch is retried with backoff, as are poison records the dead letter topic did not acknowledge.
+type Sink struct {
+	client          *Client
+	pool            *postgres.Pool
+	logger          log.Logger
+	table           string
+	columns         []string
+	mapper          SinkMapper
+	batchSize       int
+	flushInterval   time.Duration
+	conflict        conflictAction
+	conflictColumns []string
+	poison          PoisonPolicy
+	deadLetterTopic string
+}
+
+type SinkOpt func(*Sink)
+
+// WithSinkBatchSize sets the maximum number of records per batch. Defaults to 1000.
+func WithSinkBatchSize(n int) SinkOpt {
+	return func(s *Sink) {
+		s.batchSize = n
+	}
+}
+
+// WithSinkFlushInterval sets how long records are collected before a batch is flushed. Defaults to 1 second.
+func WithSinkFlushInterval(d time.Duration) SinkOpt {
+	return func(s *Sink) {
+		s.flushInterval = d
+	}
+}
+
+// WithSinkUpsert writes rows with INSERT ... ON CONFLICT DO UPDATE instead of COPY. Rows with the same values
+// in the conflict columns update the existing row; within a batch the last record wins.
+func WithSinkUpsert(conflictColumns ...string) SinkOpt {
+	return func(s *Sink) {
+		s.conflict = conflictUpdate
+		s.conflictColumns = conflictColumns
+	}
+}
+
+// WithSinkIgnoreConflicts writes rows with INSERT ... ON CONFLICT DO NOTHING instead of COPY, keeping
+// existing rows. Without conflict columns, conflicts on any unique constraint are ignored.
+func WithSinkIgnoreConflicts(conflictColumns ...string) SinkOpt {
+	return func(s *Sink) {
+		s.conflict = conflictIgnore
+		s.conflictColumns = conflictColumns
+	}
+}
+
+// WithSinkPoisonPolicy sets how poison records are handled. Defaults to PoisonStop.
+func WithSinkPoisonPolicy(p PoisonPolicy) SinkOpt {
+	return func(s *Sink) {
+		s.poison = p
+	}
+}
+
+// WithSinkDeadLetterTopic produces poison records to the topic. It implies PoisonDeadLetter.
+func WithSinkDeadLetterTopic(topic string) SinkOpt {
+	return func(s *Sink) {
+		s.poison = PoisonDeadLetter
+		s.deadLetterTopic = topic
+	}
+}
+
+// NewSink creates a sink writing the records consumed by the client to the columns of the table, which can be
+// schema qualified, e.g. "eliona_app.readings". The client must use WithGroup and WithManualCommit and must not
+// run the background consumer.
+func (c *Client) NewSink(pool *postgres.Pool, table string, columns []string, mapper SinkMapper, opts ...SinkOpt) *Sink {
+	logger := c.logger.With().Str("component", "sink").Str("table", table).Logger()
+
+	s := &Sink{
+		client:        c,
+		pool:          pool,
+		logger:        &logger,
+		table:         table,
+		columns:       columns,
+		mapper:        mapper,
+		batchSize:     defaultSinkBatchSize,
+		flushInterval: defaultSinkFlushInterval,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Run consumes and writes records until the context is canceled or the client is closed.
+// Records of an unfinished batch are not committed and will be consumed again.
+func (s *Sink) Run(ctx context.Context) error {
+	if !s.client.manualCommit {
+		return errors.New("sink: client must use WithManualCommit")
+	}
+
+	if s.poison == PoisonDeadLetter && s.deadLetterTopic == "" {
+		return errors.New("sink: dead letter policy without dead letter topic")
+	}
+
+	var (
+		batch    []*kgo.Record
+		deadline time.Time
+		delay    = minPollRetryDelay
+	)
+
+	for {
+		pollCtx, cancel := ctx, context.CancelFunc(func() {})
+		if len(batch) > 0 {
+			pollCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+
+		records, err := s.client.pollMax(pollCtx, s.batchSize-len(batch))
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if errors.Is(err, kgo.ErrClientClosed) {
+			return nil
+		}
+
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			s.client.onError(fmt.Errorf("sink: poll: %w", err))
+			s.client.sleep(ctx, delay)
+			delay = min(2*delay, maxPollRetryDelay)
+
+			continue
+		}
+
+		delay = minPollRetryDelay
+
+		if len(batch) == 0 && len(records) > 0 {
+			deadline = time.Now().Add(s.flushInterval)
+		}
+
+		batch = append(batch, s.client.collect(ctx, records)...)
+
+		if len(batch) == 0 || (len(batch) < s.batchSize && time.Now().Before(deadline)) {
+			continue
+		}
+
+		if err := s.flush(ctx, batch); err != nil {
+			return err
+		}
+
+		clear(batch)
+		batch = batch[:0]
+	}
+}
+
+type sinkRow struct {
+	record *kgo.Record
+	values []any
+}
+
+// flush writes the batch and commits its offsets. It retries until the batch is written or the context is
+// canceled and only returns errors that stop the sink.
+func (s *Sink) flush(ctx context.Context, batch []*kgo.Record) error {
+	rows := make([]sinkRow, 0, len(batch))
+	for _, r := range batch {
+		values, err := s.mapper(r)
+		if err == nil && values != nil && len(values) != len(s.columns) {
+			err = fmt.Errorf("got %d values for %d columns", len(values), len(s.columns))
+		}
+
+		if err != nil {
+			if err := s.retry(ctx, func() error {
+				return s.handlePoison(ctx, r, fmt.Errorf("map: %w", err))
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if values == nil {
+			continue
+		}
+
+		rows = append(rows, sinkRow{record: r, values: values})
+	}
+
+	if err := s.retry(ctx, func() error {
+		var err error
+		rows, err = s.writeRows(ctx, rows)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := s.client.client.CommitRecords(ctx, batch...); err != nil {
+		// The rows are written, so the records will be written again after a restart.
+		s.client.onError(fmt.Errorf("sink: commit offsets: %w", err))
+		return nil
+	}
+
+	s.client.markCommit()
+	s.logger.Debug().Int("records", len(batch)).Int("rows", len(rows)).Msg("flushed batch")
+
+	return nil
+}
+
+// retry calls fn until it succeeds, fails with a PoisonRecordError or the context is canceled. Other errors are
+// reported to the error handler and retried with backoff.
+func (s *Sink) retry(ctx context.Context, fn func() error) error {
+	delay := minSinkRetryDelay
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var poisonErr *PoisonRecordError
+		if errors.As(err, &poisonErr) || ctx.Err() != nil {
+			return err
+		}
+
+		s.client.onError(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay = min(2*delay, maxSinkRetryDelay)
+	}
+}
+
+// writeRows writes all rows in one transaction. On data errors, it falls back to writing them one by one and
+// handles failing rows as poison records. It returns the rows that still have to be written if it fails.
+func (s *Sink) writeRows(ctx context.Context, rows []sinkRow) ([]sinkRow, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	err := s.write(ctx, rows)
+	if err == nil {
+		return nil, nil
+	}
+
+	if !isDataError(err) {
+		return rows, err
+	}
+
+	s.logger.Debug().Err(err).Int("rows", len(rows)).Msg("batch failed, writing rows one by one")
+
+	for i := range rows {
+		err := s.write(ctx, rows[i:i+1])
+		if err == nil {
+			continue
+		}
+
+		if !isDataError(err) {
+			return rows[i:], err
+		}
+
+		if err := s.handlePoison(ctx, rows[i].record, err); err != nil {
+			return rows[i:], err
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *Sink) write(ctx context.Context, rows []sinkRow) error {
+	tx, err := s.pool.Tx(ctx)
+	if err != nil {
+		return fmt.Errorf("sink: begin: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if s.conflict == conflictFail {
+		values := make([][]any, len(rows))
+		for i, row := range rows {
+			values[i] = row.values
+		}
+
+		_, err = tx.CopyFrom(ctx, s.tableIdentifier(), s.columns, pgx.CopyFromRows(values))
+		if err != nil {
+			return fmt.Errorf("sink: copy: %w", err)
+		}
+	} else {
+		if s.conflict == conflictUpdate {
+			rows = s.dedupe(rows)
+		}
+
+		chunk := max(1, maxQueryParams/len(s.columns))
+		for start := 0; start < len(rows); start += chunk {
+			query, args := s.insertQuery(rows[start:min(start+chunk, len(rows))])
+			if _, err := tx.Exec(ctx, query, args...); err != nil {
+				return fmt.Errorf("sink: insert: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("sink: commit: %w", err)
+	}
+
+	return nil
+}
+
+// dedupe keeps the last row for every value of the conflict columns, as a single upsert cannot update a row twice.
+func (s *Sink) dedupe(rows []sinkRow) []sinkRow {
+	var keyColumns []int
+	for i, col := range s.columns {
+		if slices.Contains(s.conflictColumns, col) {
+			keyColumns = append(keyColumns, i)
+		}
+	}
+
+	if len(keyColumns) == 0 {
+		return rows
+	}
+
+	key := func(row sinkRow) string {
+		var b strings.Builder
+		for _, i := range keyColumns {
+			fmt.Fprintf(&b, "%v\x00", row.values[i])
+		}
+
+		return b.String()
+	}
+
+	last := make(map[string]int, len(rows))
+	for i, row := range rows {
+		last[key(row)] = i
+	}
+
+	if len(last) == len(rows) {
+		return rows
+	}
+
+	deduped := make([]sinkRow, 0, len(last))
+	for i, row := range rows {
+		if last[key(row)] == i {
+			deduped = append(deduped, row)
+		}
+	}
+
+	return deduped
+}
+
+func (s *Sink) insertQuery(rows []sinkRow) (string, []any) {
+	columns := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		columns[i] = postgres.SanitizedIdentifier(col)
+	}
+
+	var query strings.Builder
+	fmt.Fprintf(&query, "INSERT INTO %s (%s) VALUES ", s.tableIdentifier().Sanitize(), strings.Join(columns, ", "))
+
+	args := make([]any, 0, len(rows)*len(s.columns))
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+
+		query.WriteByte('(')
+		for j, v := range row.values {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+
+			args = append(args, v)
+			query.WriteString("$" + strconv.Itoa(len(args)))
+		}
+		query.WriteByte(')')
+	}
+
+	conflictColumns := make([]string, len(s.conflictColumns))
+	for i, col := range s.conflictColumns {
+		conflictColumns[i] = postgres.SanitizedIdentifier(col)
+	}
+
+	target := ""
+	if len(conflictColumns) > 0 {
+		target = " (" + strings.Join(conflictColumns, ", ") + ")"
+	}
+
+	var updates []string
+	if s.conflict == conflictUpdate {
+		for i, col := range s.columns {
+			if !slices.Contains(s.conflictColumns, col) {
+				updates = append(updates, columns[i]+" = EXCLUDED."+columns[i])
+			}
+		}
+	}
+
+	if len(updates) > 0 {
+		fmt.Fprintf(&query, " ON CONFLICT%s DO UPDATE SET %s", target, strings.Join(updates, ", "))
+	} else {
+		fmt.Fprintf(&query, " ON CONFLICT%s DO NOTHING", target)
+	}
+
+	return query.String(), args
+}
+
+// tableIdentifier splits a schema qualified table name into its parts, so both are quoted separately.
+func (s *Sink) tableIdentifier() pgx.Identifier {
+	return pgx.Identifier(strings.Split(s.table, "."))
+}
+
+// handlePoison handles the record according to the poison policy. Records for the dead letter topic are produced
+// synchronously, so the batch is not committed before the broker acknowledged them. As the record passed the
+// consuming middlewares, it is produced through the produce interceptors, so it is encoded like any other record.
+func (s *Sink) handlePoison(ctx context.Context, r *kgo.Record, err error) error {
+	switch s.poison {
+	case PoisonSkip:
+		s.client.onError(fmt.Errorf("sink: skip poison record %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+	case PoisonDeadLetter:
+		dlq := deadLetterRecord(r, s.deadLetterTopic, err)
+		if err := s.client.produceSync(ctx, dlq).FirstErr(); err != nil {
+			return fmt.Errorf("sink: dead letter %s/%d@%d to %q: %w", r.Topic, r.Partition, r.Offset, s.deadLetterTopic, err)
+		}
+	default:
+		return &PoisonRecordError{Topic: r.Topic, Partition: r.Partition, Offset: r.Offset, Err: err}
+	}
+
+	return nil
+}
+
+// isDataError reports whether the error is caused by the written data rather than the connection or the server,
+// i.e. retrying the same rows fails again.
+func isDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || len(pgErr.Code) < 2 {
+		return false
+	}
+
+	switch pgErr.Code[:2] {
+	case "22", // data exception
+		"23": // integrity constraint violation
+		return true
+	}
+
+	return false
+}
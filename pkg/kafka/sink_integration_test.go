@@ -0,0 +1,92 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+)
+
+func TestSinkRun(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	_, err := pool.Exec(ctx, `
+		CREATE SCHEMA IF NOT EXISTS frm_test;
+		DROP TABLE IF EXISTS frm_test.readings;
+		CREATE TABLE frm_test.readings (id int PRIMARY KEY, value int NOT NULL CHECK (value >= 0))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), "DROP SCHEMA frm_test CASCADE")
+	})
+
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "readings", "readings-dlq")
+
+	// "x" cannot be mapped and -1 violates the check constraint, so both are poison records.
+	cluster.ProduceValues("readings", "1:10", "x", "2:-1", "3:30")
+
+	client := cluster.NewClient(
+		kafka.WithGroup("readings-sink"),
+		kafka.WithManualCommit(),
+		kafka.WithMaxFetchCount(10),
+	)
+	client.AddConsumeTopic("readings")
+
+	mapper := func(r kafka.Record) ([]any, error) {
+		id, value, ok := strings.Cut(string(r.Value), ":")
+		if !ok {
+			return nil, errors.New("invalid reading")
+		}
+
+		i, _ := strconv.Atoi(id)
+		v, _ := strconv.Atoi(value)
+
+		return []any{i, v}, nil
+	}
+
+	sink := client.NewSink(pool, "frm_test.readings", []string{"id", "value"}, mapper,
+		kafka.WithSinkDeadLetterTopic("readings-dlq"),
+		kafka.WithSinkFlushInterval(50*time.Millisecond),
+	)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- sink.Run(runCtx)
+	}()
+
+	cluster.AssertCommitted("readings-sink", "readings", 0, 4)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v from Run, want %v", err, context.Canceled)
+	}
+
+	ids, err := postgres.CollectColumn[int](ctx, pool, "SELECT id FROM frm_test.readings ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("got written IDs %v, want [1 3]", ids)
+	}
+
+	dlq := cluster.ConsumeAll("readings-dlq")
+	if len(dlq) != 2 || string(dlq[0].Value) != "x" || string(dlq[1].Value) != "2:-1" {
+		t.Fatalf("got %d dead letter records, want x and 2:-1", len(dlq))
+	}
+
+	if _, ok := kafka.HeaderValue(dlq[0], kafka.HeaderDeadLetterReason); !ok {
+		t.Error("dead letter record has no reason")
+	}
+}
@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestSinkInsertQuery(t *testing.T) {
+	rows := []sinkRow{
+		{values: []any{1, "a"}},
+		{values: []any{2, "b"}},
+	}
+
+	tests := []struct {
+		name  string
+		table string
+		opt   SinkOpt
+		want  string
+	}{
+		{
+			name: "upsert",
+			opt:  WithSinkUpsert("id"),
+			want: `INSERT INTO "readings" ("id", "value") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "value" = EXCLUDED."value"`,
+		},
+		{
+			name: "ignore",
+			opt:  WithSinkIgnoreConflicts(),
+			want: `INSERT INTO "readings" ("id", "value") VALUES ($1, $2), ($3, $4) ON CONFLICT DO NOTHING`,
+		},
+		{
+			name:  "schema qualified",
+			table: "eliona_app.readings",
+			opt:   WithSinkIgnoreConflicts(),
+			want:  `INSERT INTO "eliona_app"."readings" ("id", "value") VALUES ($1, $2), ($3, $4) ON CONFLICT DO NOTHING`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := tt.table
+			if table == "" {
+				table = "readings"
+			}
+
+			s := &Sink{table: table, columns: []string{"id", "value"}}
+			tt.opt(s)
+
+			query, args := s.insertQuery(rows)
+			if query != tt.want {
+				t.Errorf("got query\n%s\nwant\n%s", query, tt.want)
+			}
+
+			if len(args) != 4 {
+				t.Errorf("got %d args, want 4", len(args))
+			}
+		})
+	}
+}
+
+func TestSinkDedupe(t *testing.T) {
+	s := &Sink{columns: []string{"id", "value"}, conflictColumns: []string{"id"}}
+
+	rows := s.dedupe([]sinkRow{
+		{values: []any{1, "a"}},
+		{values: []any{2, "b"}},
+		{values: []any{1, "c"}},
+	})
+
+	if got := fmt.Sprint(rows[0].values, rows[1].values); len(rows) != 2 || got != "[2 b] [1 c]" {
+		t.Errorf("got rows %s, want [2 b] [1 c]", got)
+	}
+}
+
+func TestIsDataError(t *testing.T) {
+	for code, want := range map[string]bool{"23505": true, "22P02": true, "40001": false, "57P01": false} {
+		err := fmt.Errorf("sink: insert: %w", &pgconn.PgError{Code: code})
+		if got := isDataError(err); got != want {
+			t.Errorf("code %s: got %t, want %t", code, got, want)
+		}
+	}
+}
+
+func TestSinkDeadLetter(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(1, "readings-dlq"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+
+	// Dead-lettered records pass through the produce interceptors, e.g. to be encrypted again.
+	var intercepted []string
+	client, err := New(
+		Seeds(cluster.ListenAddrs()...),
+		WithProduceInterceptors(func(_ context.Context, r Record) error {
+			intercepted = append(intercepted, r.Topic)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	s := &Sink{client: client, poison: PoisonDeadLetter, deadLetterTopic: "readings-dlq"}
+	poison := &kgo.Record{Topic: "readings", Value: []byte("not a reading")}
+
+	if err := s.handlePoison(context.Background(), poison, errors.New("invalid")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(intercepted) != 1 || intercepted[0] != "readings-dlq" {
+		t.Errorf("got intercepted topics %v, want [readings-dlq]", intercepted)
+	}
+
+	cluster.ControlKey(int16(kmsg.Produce), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.KeepControl()
+
+		produce := req.(*kmsg.ProduceRequest)
+		resp := produce.ResponseKind().(*kmsg.ProduceResponse)
+		resp.SetVersion(produce.GetVersion())
+
+		for _, rt := range produce.Topics {
+			st := kmsg.NewProduceResponseTopic()
+			st.Topic = rt.Topic
+			st.TopicID = rt.TopicID
+
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewProduceResponseTopicPartition()
+				sp.Partition = rp.Partition
+				sp.ErrorCode = kerr.InvalidRecord.Code
+				st.Partitions = append(st.Partitions, sp)
+			}
+
+			resp.Topics = append(resp.Topics, st)
+		}
+
+		return resp, nil, true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = s.handlePoison(ctx, poison, errors.New("invalid"))
+	if !errors.Is(err, kerr.InvalidRecord) {
+		t.Errorf("got error %v, want %v", err, kerr.InvalidRecord)
+	}
+}
@@ -0,0 +1,264 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// TableChange describes an update of a single key of a Table.
+type TableChange[V any] struct {
+	Key     string
+	Value   V
+	Deleted bool
+	// Previous holds the value before the change if HadPrevious is set.
+	Previous    V
+	HadPrevious bool
+}
+
+// Table materializes the latest value per key of a compacted topic in memory.
+//
+// The table consumes its topic from the beginning with a dedicated client that is not part of a consumer group,
+// so every instance holds the complete table. Records with a nil value (tombstones) remove the key.
+type Table[V any] struct {
+	client *Client
+	topic  string
+	decode func(value []byte) (V, error)
+
+	mu   sync.RWMutex
+	data map[string]V
+
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	subsMu      sync.Mutex
+	subscribers map[int]func(TableChange[V])
+	nextSubID   int
+}
+
+// NewTable creates a table for the given compacted topic. Values are converted with decode; records failing to
+// decode are skipped and reported to the error handler of the client.
+//
+// The options are used to create the underlying client and must not contain WithGroup or WithSubscriptions.
+func NewTable[V any](topic string, decode func(value []byte) (V, error), opts ...Opt) (*Table[V], error) {
+	// Control records are kept to see the end of partitions that end with a transaction marker.
+	keepControl := func(c *Client) {
+		c.opts = append(c.opts, kgo.KeepControlRecords())
+	}
+
+	client, err := New(append(opts, keepControl)...)
+	if err != nil {
+		return nil, err
+	}
+
+	client.client.AddConsumeTopics(topic)
+
+	return &Table[V]{
+		client:      client,
+		topic:       topic,
+		decode:      decode,
+		data:        make(map[string]V),
+		ready:       make(chan struct{}),
+		subscribers: make(map[int]func(TableChange[V])),
+	}, nil
+}
+
+// Run consumes the topic until the context is canceled or the table is closed.
+func (t *Table[V]) Run(ctx context.Context) error {
+	pending, err := t.pendingOffsets(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.checkCaughtUp(pending)
+
+	for {
+		fetches := t.client.client.PollRecords(ctx, t.client.maxFetches)
+		if fetches.IsClientClosed() {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if errs := fetches.Errors(); len(errs) > 0 {
+			for i := range errs {
+				t.client.onError(wrapKgoConsumerError(errs[i].Err))
+			}
+
+			continue
+		}
+
+		t.client.markPoll()
+
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			for _, r := range p.Records {
+				t.apply(r)
+			}
+
+			if n := len(p.Records); n > 0 {
+				if end, ok := pending[p.Partition]; ok && p.Records[n-1].Offset+1 >= end {
+					delete(pending, p.Partition)
+				}
+			}
+		})
+
+		t.checkCaughtUp(pending)
+	}
+}
+
+// pendingOffsets returns the end offsets of all partitions that are not empty at the time of the call.
+// The table is caught up once it consumed all of them, including the transaction markers (control records)
+// partitions may end with.
+func (t *Table[V]) pendingOffsets(ctx context.Context) (map[int32]int64, error) {
+	admin := kadm.NewClient(t.client.client)
+
+	starts, err := admin.ListStartOffsets(ctx, t.topic)
+	if err == nil {
+		err = starts.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("table %q: list start offsets: %w", t.topic, err)
+	}
+
+	ends, err := admin.ListEndOffsets(ctx, t.topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("table %q: list end offsets: %w", t.topic, err)
+	}
+
+	pending := make(map[int32]int64)
+	ends.Each(func(end kadm.ListedOffset) {
+		start, ok := starts.Lookup(end.Topic, end.Partition)
+		if ok && start.Offset >= end.Offset {
+			return
+		}
+
+		pending[end.Partition] = end.Offset
+	})
+
+	return pending, nil
+}
+
+func (t *Table[V]) checkCaughtUp(pending map[int32]int64) {
+	if len(pending) == 0 {
+		t.readyOnce.Do(func() {
+			close(t.ready)
+		})
+	}
+}
+
+func (t *Table[V]) apply(r *kgo.Record) {
+	if r.Attrs.IsControl() {
+		return
+	}
+
+	change := TableChange[V]{Key: string(r.Key)}
+
+	if r.Value == nil {
+		change.Deleted = true
+	} else {
+		value, err := t.decode(r.Value)
+		if err != nil {
+			t.client.onError(fmt.Errorf("table %q: decode key %q at offset %d: %w", t.topic, r.Key, r.Offset, err))
+			return
+		}
+
+		change.Value = value
+	}
+
+	t.mu.Lock()
+	change.Previous, change.HadPrevious = t.data[change.Key]
+	if change.Deleted {
+		delete(t.data, change.Key)
+	} else {
+		t.data[change.Key] = change.Value
+	}
+	t.mu.Unlock()
+
+	if change.Deleted && !change.HadPrevious {
+		return
+	}
+
+	// Callbacks run without the lock, so they can subscribe and unsubscribe.
+	t.subsMu.Lock()
+	subscribers := make([]func(TableChange[V]), 0, len(t.subscribers))
+	for _, fn := range t.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	t.subsMu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(change)
+	}
+}
+
+// Ready returns a channel that is closed once the table has consumed all records that existed when Run was called.
+func (t *Table[V]) Ready() <-chan struct{} {
+	return t.ready
+}
+
+// WaitReady blocks until the table is caught up or the context is done.
+func (t *Table[V]) WaitReady(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Table[V]) Get(key string) (V, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	v, ok := t.data[key]
+
+	return v, ok
+}
+
+func (t *Table[V]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.data)
+}
+
+// Snapshot returns a copy of the current table content.
+func (t *Table[V]) Snapshot() map[string]V {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snapshot := make(map[string]V, len(t.data))
+	for k, v := range t.data {
+		snapshot[k] = v
+	}
+
+	return snapshot
+}
+
+// Subscribe registers fn to be called for every change of the table. Callbacks are invoked sequentially from the
+// consuming goroutine and must not block. The returned function removes the subscription.
+func (t *Table[V]) Subscribe(fn func(TableChange[V])) func() {
+	t.subsMu.Lock()
+	id := t.nextSubID
+	t.nextSubID++
+	t.subscribers[id] = fn
+	t.subsMu.Unlock()
+
+	return func() {
+		t.subsMu.Lock()
+		delete(t.subscribers, id)
+		t.subsMu.Unlock()
+	}
+}
+
+func (t *Table[V]) Close() {
+	t.client.Close()
+}
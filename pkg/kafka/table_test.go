@@ -0,0 +1,140 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/kafka/kafkatest"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestTableReadyWithTransactionMarker(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "assets")
+	// The partition ends at offset 2, like a record followed by the commit marker of its transaction.
+	cluster.ProduceValues("assets", "a", "b")
+
+	// The first fetch returns the record at offset 0 and a commit marker at offset 1.
+	cluster.Fake().ControlKey(int16(kmsg.Fetch), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		fetch := req.(*kmsg.FetchRequest)
+		resp := fetch.ResponseKind().(*kmsg.FetchResponse)
+		resp.SetVersion(fetch.GetVersion())
+
+		for _, rt := range fetch.Topics {
+			st := kmsg.NewFetchResponseTopic()
+			st.Topic = rt.Topic
+			st.TopicID = rt.TopicID
+
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewFetchResponseTopicPartition()
+				sp.Partition = rp.Partition
+				sp.HighWatermark = 2
+				sp.LastStableOffset = 2
+				sp.RecordBatches = append(
+					recordBatch(0, 0, kmsg.Record{Key: []byte("a"), Value: []byte("1")}),
+					recordBatch(1, 0x30, kmsg.Record{Key: []byte{0, 0, 0, 1}, Value: []byte{0, 0, 0, 0, 0, 0}})...,
+				)
+				st.Partitions = append(st.Partitions, sp)
+			}
+
+			resp.Topics = append(resp.Topics, st)
+		}
+
+		return resp, nil, true
+	})
+
+	table, err := kafka.NewTable("assets", func(v []byte) (string, error) {
+		return string(v), nil
+	}, kafka.Seeds(cluster.Addrs()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	go func() {
+		_ = table.Run(ctx)
+	}()
+
+	if err := table.WaitReady(ctx); err != nil {
+		t.Fatalf("table not ready: %v", err)
+	}
+
+	if v, ok := table.Get("a"); !ok || v != "1" || table.Len() != 1 {
+		t.Errorf("got value %q, %t and %d keys, want only a=1", v, ok, table.Len())
+	}
+}
+
+func TestTableSubscribeFromCallback(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedTopics(1, "assets")
+
+	table, err := kafka.NewTable("assets", func(v []byte) (string, error) {
+		return string(v), nil
+	}, kafka.Seeds(cluster.Addrs()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkatest.DefaultTimeout)
+	defer cancel()
+
+	changes := make(chan kafka.TableChange[string], 1)
+
+	var unsubscribe func()
+	unsubscribe = table.Subscribe(func(change kafka.TableChange[string]) {
+		// Unsubscribing from the callback must not deadlock.
+		unsubscribe()
+		changes <- change
+	})
+
+	go func() {
+		_ = table.Run(ctx)
+	}()
+
+	if err := table.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster.ProduceValues("assets", "a")
+
+	select {
+	case change := <-changes:
+		if change.Value != "a" {
+			t.Errorf("got value %q, want a", change.Value)
+		}
+	case <-time.After(kafkatest.DefaultTimeout):
+		t.Fatal("callback was not called")
+	}
+}
+
+// recordBatch encodes a record batch with a single record at the offset.
+func recordBatch(offset int64, attrs int16, r kmsg.Record) []byte {
+	r.Length = int32(len(r.AppendTo(nil)) - 1)
+
+	batch := kmsg.RecordBatch{
+		FirstOffset:   offset,
+		Magic:         2,
+		Attributes:    attrs,
+		ProducerID:    -1,
+		ProducerEpoch: -1,
+		FirstSequence: -1,
+		NumRecords:    1,
+		Records:       r.AppendTo(nil),
+	}
+	// The length counts the bytes after the length field, the CRC the bytes after the CRC field.
+	batch.Length = int32(len(batch.AppendTo(nil)) - 12)
+
+	raw := batch.AppendTo(nil)
+	binary.BigEndian.PutUint32(raw[17:21], crc32.Checksum(raw[21:], crc32.MakeTable(crc32.Castagnoli)))
+
+	return raw
+}
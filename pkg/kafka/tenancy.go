@@ -0,0 +1,208 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/httputil"
+)
+
+const (
+	// HeaderTenantID holds the tenant of a record. It matches the tenant_id claim of httputil.ElionaJWT.
+	HeaderTenantID = "tenant_id"
+)
+
+var (
+	ErrMissingTenant  = errors.New("missing tenant")
+	ErrInvalidTenant  = errors.New("invalid tenant")
+	ErrTenantMismatch = errors.New("tenant mismatch")
+)
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a context carrying the tenant ID.
+func ContextWithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID set with ContextWithTenant or, if there is none,
+// the tenant_id claim stored by the httputil authorization middleware.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok && id != "" {
+		return id, true
+	}
+
+	if claims, ok := httputil.ClaimsFromContext(ctx); ok && claims.TenantID != "" {
+		return claims.TenantID, true
+	}
+
+	return "", false
+}
+
+type TenancyOpt func(*tenancy)
+
+// WithTenantTopicTemplate routes produced records to per-tenant topics. The placeholders {tenant} and {topic}
+// are replaced by the tenant ID and the topic of the record, e.g. "tenant-{tenant}.{topic}".
+//
+// Records whose topic already is a tenant topic, e.g. from Client.TenantTopic, keep it. The template must yield
+// the topic for the tenant of the record, otherwise they fail with ErrTenantMismatch when produced and are dropped
+// when consumed.
+func WithTenantTopicTemplate(template string) TenancyOpt {
+	return func(t *tenancy) {
+		t.topicTemplate = template
+		t.topicPattern = nil
+
+		if strings.Contains(template, "{tenant}") {
+			pattern := regexp.QuoteMeta(template)
+			pattern = strings.ReplaceAll(pattern, regexp.QuoteMeta("{tenant}"), ".+")
+			pattern = strings.ReplaceAll(pattern, regexp.QuoteMeta("{topic}"), ".+")
+			t.topicPattern = regexp.MustCompile("^" + pattern + "$")
+		}
+	}
+}
+
+// WithTenantValidator sets a function validating tenant IDs of produced and consumed records.
+// By default, any non-empty tenant ID is valid.
+func WithTenantValidator(fn func(tenantID string) error) TenancyOpt {
+	return func(t *tenancy) {
+		t.validate = fn
+	}
+}
+
+type tenancy struct {
+	topicTemplate string
+	topicPattern  *regexp.Regexp
+	validate      func(tenantID string) error
+}
+
+func (t *tenancy) check(tenantID string) error {
+	if tenantID == "" {
+		return ErrMissingTenant
+	}
+
+	if t.validate == nil {
+		return nil
+	}
+
+	if err := t.validate(tenantID); err != nil {
+		return fmt.Errorf("%w %q: %w", ErrInvalidTenant, tenantID, err)
+	}
+
+	return nil
+}
+
+// checkTopic verifies that a tenant topic is a topic of the tenant. It reports whether the topic is a tenant topic.
+func (t *tenancy) checkTopic(tenantID, topic string) (bool, error) {
+	if t.topicPattern == nil || !t.topicPattern.MatchString(topic) {
+		return false, nil
+	}
+
+	if !t.ownsTopic(tenantID, topic) {
+		return true, fmt.Errorf("%w: topic %q is not a topic of tenant %q", ErrTenantMismatch, topic, tenantID)
+	}
+
+	return true, nil
+}
+
+// ownsTopic reports whether the template yields the topic for the tenant. Unlike parsing the topic, this works
+// for tenant IDs and topics containing the separators of the template.
+func (t *tenancy) ownsTopic(tenantID, topic string) bool {
+	prefix, suffix, ok := strings.Cut(strings.ReplaceAll(t.topicTemplate, "{tenant}", tenantID), "{topic}")
+	if !ok {
+		return topic == prefix
+	}
+
+	return len(topic) > len(prefix)+len(suffix) && strings.HasPrefix(topic, prefix) && strings.HasSuffix(topic, suffix)
+}
+
+func (t *tenancy) topic(tenantID, topic string) string {
+	if t.topicTemplate == "" {
+		return topic
+	}
+
+	return strings.NewReplacer("{tenant}", tenantID, "{topic}", topic).Replace(t.topicTemplate)
+}
+
+// WithTenancy enforces tenant IDs on all records.
+//
+// Produced records get the tenant_id header from the context (see TenantFromContext) unless they already have one,
+// and are routed to the tenant topic if a template is configured. Records without a valid tenant fail with
+// ErrMissingTenant or ErrInvalidTenant, records whose tenant header differs from the tenant of the context with
+// ErrTenantMismatch. Consumed records without a valid tenant header are not passed to the handler; pull-style
+// consumers receive them with the error, otherwise the error is reported to the error handler. For all others the
+// handler receives the tenant in the record context.
+//
+// Register WithTenancy before WithSigning if the tenant header is signed.
+func WithTenancy(opts ...TenancyOpt) Opt {
+	t := &tenancy{}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return func(c *Client) {
+		c.tenancy = t
+		c.interceptors = append(c.interceptors, t.intercept)
+		c.middlewares = append(c.middlewares, t.middleware(c))
+	}
+}
+
+func (t *tenancy) intercept(ctx context.Context, r Record) error {
+	contextTenant, _ := TenantFromContext(ctx)
+
+	tenantID, ok := HeaderValue(r, HeaderTenantID)
+	if !ok {
+		tenantID = []byte(contextTenant)
+	} else if contextTenant != "" && contextTenant != string(tenantID) {
+		return fmt.Errorf("tenancy: produce to %q: %w: header %q, context %q",
+			r.Topic, ErrTenantMismatch, tenantID, contextTenant)
+	}
+
+	if err := t.check(string(tenantID)); err != nil {
+		return fmt.Errorf("tenancy: produce to %q: %w", r.Topic, err)
+	}
+
+	tenantTopic, err := t.checkTopic(string(tenantID), r.Topic)
+	if err != nil {
+		return fmt.Errorf("tenancy: produce to %q: %w", r.Topic, err)
+	}
+
+	SetHeader(r, HeaderTenantID, tenantID)
+	if !tenantTopic {
+		r.Topic = t.topic(string(tenantID), r.Topic)
+	}
+
+	return nil
+}
+
+func (t *tenancy) middleware(c *Client) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Record) {
+			tenantID, _ := HeaderValue(r, HeaderTenantID)
+			err := t.check(string(tenantID))
+			if err == nil {
+				_, err = t.checkTopic(string(tenantID), r.Topic)
+			}
+
+			if err != nil {
+				c.fail(r, fmt.Errorf("tenancy: %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+				return
+			}
+
+			r.Context = ContextWithTenant(c.recordContext(r), string(tenantID))
+			next(r)
+		}
+	}
+}
+
+// TenantTopic returns the topic name of the tenant according to the template configured with WithTenancy.
+// Use it to subscribe to per-tenant topics.
+func (c *Client) TenantTopic(tenantID string, topic string) string {
+	if c.tenancy == nil {
+		return topic
+	}
+
+	return c.tenancy.topic(tenantID, topic)
+}
@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestTenancyProduce(t *testing.T) {
+	tn := &tenancy{topicTemplate: "tenant-{tenant}.{topic}"}
+
+	r := &kgo.Record{Topic: "bookings"}
+	if err := tn.intercept(ContextWithTenant(context.Background(), "t1"), r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Topic != "tenant-t1.bookings" {
+		t.Errorf("got topic %q, want tenant-t1.bookings", r.Topic)
+	}
+
+	if v, _ := HeaderValue(r, HeaderTenantID); string(v) != "t1" {
+		t.Errorf("got tenant header %q, want t1", v)
+	}
+
+	err := tn.intercept(context.Background(), &kgo.Record{Topic: "bookings"})
+	if !errors.Is(err, ErrMissingTenant) {
+		t.Errorf("got error %v, want %v", err, ErrMissingTenant)
+	}
+}
+
+func TestTenancyConsume(t *testing.T) {
+	tn := &tenancy{validate: func(id string) error {
+		if id != "t1" {
+			return errors.New("unknown tenant")
+		}
+		return nil
+	}}
+
+	var reported []error
+	c := &Client{onError: func(err error) { reported = append(reported, err) }}
+
+	var tenants []string
+	handler := tn.middleware(c)(func(r Record) {
+		id, _ := TenantFromContext(r.Context)
+		tenants = append(tenants, id)
+	})
+
+	for _, tenant := range []string{"t1", "t2", ""} {
+		r := &kgo.Record{Topic: "bookings", Context: context.Background()}
+		if tenant != "" {
+			SetHeader(r, HeaderTenantID, []byte(tenant))
+		}
+		handler(r)
+	}
+
+	if len(tenants) != 1 || tenants[0] != "t1" {
+		t.Errorf("got handled tenants %v, want [t1]", tenants)
+	}
+
+	if len(reported) != 2 || !errors.Is(reported[0], ErrInvalidTenant) || !errors.Is(reported[1], ErrMissingTenant) {
+		t.Errorf("got errors %v", reported)
+	}
+}
+
+func TestTenancyTenantTopic(t *testing.T) {
+	tn := &tenancy{}
+	WithTenantTopicTemplate("tenant-{tenant}.{topic}")(tn)
+
+	r := &kgo.Record{Topic: "tenant-t1.bookings"}
+	if err := tn.intercept(ContextWithTenant(context.Background(), "t1"), r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Topic != "tenant-t1.bookings" {
+		t.Errorf("got topic %q, want the tenant topic unchanged", r.Topic)
+	}
+
+	mismatched := []*kgo.Record{
+		{Topic: "tenant-t1.bookings"},
+		{Topic: "tenant-t1.bookings", Headers: []kgo.RecordHeader{{Key: HeaderTenantID, Value: []byte("t2")}}},
+		{Topic: "bookings", Headers: []kgo.RecordHeader{{Key: HeaderTenantID, Value: []byte("t1")}}},
+	}
+
+	for _, r := range mismatched {
+		err := tn.intercept(ContextWithTenant(context.Background(), "t2"), r)
+		if !errors.Is(err, ErrTenantMismatch) {
+			t.Errorf("got error %v, want %v", err, ErrTenantMismatch)
+		}
+	}
+
+	var reported []error
+	c := &Client{onError: func(err error) { reported = append(reported, err) }}
+
+	var handled []string
+	handler := tn.middleware(c)(func(r Record) {
+		id, _ := TenantFromContext(r.Context)
+		handled = append(handled, id)
+	})
+
+	for _, tenant := range []string{"t1", "t2"} {
+		r := &kgo.Record{Topic: "tenant-t1.bookings", Context: context.Background()}
+		SetHeader(r, HeaderTenantID, []byte(tenant))
+		handler(r)
+	}
+
+	if len(handled) != 1 || handled[0] != "t1" {
+		t.Errorf("got handled tenants %v, want [t1]", handled)
+	}
+
+	if len(reported) != 1 || !errors.Is(reported[0], ErrTenantMismatch) {
+		t.Errorf("got errors %v, want %v", reported, ErrTenantMismatch)
+	}
+}
+
+func TestTenancyTenantTopicWithSeparators(t *testing.T) {
+	tn := &tenancy{}
+	WithTenantTopicTemplate("tenant-{tenant}.{topic}")(tn)
+
+	tests := []struct {
+		tenant string
+		topic  string
+		want   string
+	}{
+		{"a.b", "bookings", "tenant-a.b.bookings"},
+		{"a.b", "tenant-a.b.bookings", "tenant-a.b.bookings"},
+		{"a", "tenant-a.floor.plans", "tenant-a.floor.plans"},
+	}
+
+	for _, tt := range tests {
+		r := &kgo.Record{Topic: tt.topic}
+		if err := tn.intercept(ContextWithTenant(context.Background(), tt.tenant), r); err != nil {
+			t.Errorf("tenant %q, topic %q: %v", tt.tenant, tt.topic, err)
+			continue
+		}
+
+		if r.Topic != tt.want {
+			t.Errorf("got topic %q for tenant %q, want %q", r.Topic, tt.tenant, tt.want)
+		}
+	}
+
+	r := &kgo.Record{Topic: "tenant-a.b.bookings", Context: context.Background()}
+	SetHeader(r, HeaderTenantID, []byte("a.b"))
+
+	handled := false
+	c := &Client{onError: func(err error) { t.Error(err) }}
+	tn.middleware(c)(func(Record) { handled = true })(r)
+
+	if !handled {
+		t.Error("record of tenant a.b not handled")
+	}
+}
@@ -0,0 +1,252 @@
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	HeaderTraceParent   = "traceparent"
+	HeaderTraceState    = "tracestate"
+	HeaderCorrelationID = "correlation_id"
+)
+
+type SpanKind int
+
+const (
+	SpanKindProducer SpanKind = iota
+	SpanKindConsumer
+)
+
+// Tracer starts spans. Its shape follows the OpenTelemetry tracer, so it can be implemented by a thin adapter.
+type Tracer interface {
+	Start(ctx context.Context, spanName string, kind SpanKind) (context.Context, Span)
+}
+
+type Span interface {
+	RecordError(err error)
+	End()
+}
+
+// SpanContextProvider is implemented by spans that expose their span context. The span context of producer spans
+// implementing it is written into the record headers, so consumer spans become children of the producer span.
+// OpenTelemetry adapters do not need it, as the OpenTelemetry propagator reads the span from the context.
+type SpanContextProvider interface {
+	SpanContext() SpanContext
+}
+
+// TextMapCarrier has the same method set as the OpenTelemetry propagation.TextMapCarrier.
+type TextMapCarrier interface {
+	Get(key string) string
+	Set(key string, value string)
+	Keys() []string
+}
+
+// Propagator injects and extracts trace context. Its shape follows the OpenTelemetry
+// propagation.TextMapPropagator, which can be used directly through a small adapter.
+type Propagator interface {
+	Inject(ctx context.Context, carrier TextMapCarrier)
+	Extract(ctx context.Context, carrier TextMapCarrier) context.Context
+}
+
+// HeaderCarrier adapts record headers to a TextMapCarrier.
+type HeaderCarrier struct {
+	Record Record
+}
+
+func (h HeaderCarrier) Get(key string) string {
+	v, _ := HeaderValue(h.Record, key)
+
+	return string(v)
+}
+
+func (h HeaderCarrier) Set(key string, value string) {
+	SetHeader(h.Record, key, []byte(value))
+}
+
+func (h HeaderCarrier) Keys() []string {
+	keys := make([]string, len(h.Record.Headers))
+	for i := range h.Record.Headers {
+		keys[i] = h.Record.Headers[i].Key
+	}
+
+	return keys
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ SpanKind) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) RecordError(error) {}
+func (noopSpan) End()              {}
+
+// SpanContext identifies a span according to W3C Trace Context.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats the span context as traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// ParseTraceParent parses a traceparent header value of version 00.
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid trace ID: %w", err)
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid span ID: %w", err)
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, fmt.Errorf("invalid trace flags: %w", err)
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return sc, errors.New("traceparent with zero trace or span ID")
+	}
+
+	return sc, nil
+}
+
+// NewSpanContext returns a sampled span context with random IDs.
+func NewSpanContext() SpanContext {
+	sc := SpanContext{Flags: 0x01}
+	_, _ = rand.Read(sc.TraceID[:])
+	_, _ = rand.Read(sc.SpanID[:])
+
+	return sc
+}
+
+type spanContextKey struct{}
+
+type correlationIDKey struct{}
+
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+
+	return sc, ok && sc.IsValid()
+}
+
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+
+	return id, ok && id != ""
+}
+
+// TraceContext propagates span contexts stored with ContextWithSpanContext using the W3C
+// traceparent and tracestate headers.
+type TraceContext struct{}
+
+func (TraceContext) Inject(ctx context.Context, carrier TextMapCarrier) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	carrier.Set(HeaderTraceParent, sc.TraceParent())
+	if sc.TraceState != "" {
+		carrier.Set(HeaderTraceState, sc.TraceState)
+	}
+}
+
+func (TraceContext) Extract(ctx context.Context, carrier TextMapCarrier) context.Context {
+	sc, err := ParseTraceParent(carrier.Get(HeaderTraceParent))
+	if err != nil {
+		return ctx
+	}
+
+	sc.TraceState = carrier.Get(HeaderTraceState)
+	sc.Remote = true
+
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// injectTrace starts a producer span and writes its trace context and the correlation ID of ctx into the record
+// headers. The caller ends the span with endSpan once the record was produced.
+func (c *Client) injectTrace(ctx context.Context, r Record) Span {
+	ctx, span := c.tracer.Start(ctx, r.Topic+" publish", SpanKindProducer)
+	if p, ok := span.(SpanContextProvider); ok {
+		if sc := p.SpanContext(); sc.IsValid() {
+			ctx = ContextWithSpanContext(ctx, sc)
+		}
+	}
+
+	carrier := HeaderCarrier{Record: r}
+	c.propagator.Inject(ctx, carrier)
+
+	if id, ok := CorrelationIDFromContext(ctx); ok {
+		carrier.Set(HeaderCorrelationID, id)
+	}
+
+	return span
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	span.End()
+}
+
+// traceMiddleware extracts trace context and correlation ID from the record headers and starts a consumer span.
+// The handler receives the resulting context as the record context.
+func (c *Client) traceMiddleware(next HandlerFunc) HandlerFunc {
+	return func(r Record) {
+		ctx := c.recordContext(r)
+
+		carrier := HeaderCarrier{Record: r}
+		ctx = c.propagator.Extract(ctx, carrier)
+
+		if id := carrier.Get(HeaderCorrelationID); id != "" {
+			ctx = ContextWithCorrelationID(ctx, id)
+		}
+
+		ctx, span := c.tracer.Start(ctx, r.Topic+" process", SpanKindConsumer)
+		defer span.End()
+
+		r.Context = ctx
+		next(r)
+	}
+}
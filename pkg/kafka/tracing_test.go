@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceParent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sc.TraceParent(); got != valid {
+		t.Errorf("got %s, want %s", got, valid)
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	}
+
+	for _, s := range invalid {
+		if _, err := ParseTraceParent(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	c := &Client{tracer: noopTracer{}, propagator: TraceContext{}}
+
+	sc := NewSpanContext()
+	sc.TraceState = "vendor=value"
+	ctx := ContextWithCorrelationID(ContextWithSpanContext(context.Background(), sc), "req-1")
+
+	r := &kgo.Record{Topic: "bookings"}
+	c.injectTrace(ctx, r).End()
+
+	r.Context = context.Background()
+
+	var handled context.Context
+	c.traceMiddleware(func(r Record) { handled = r.Context })(r)
+
+	got, ok := SpanContextFromContext(handled)
+	if !ok {
+		t.Fatal("span context not extracted")
+	}
+
+	if got.TraceID != sc.TraceID || got.SpanID != sc.SpanID || got.TraceState != sc.TraceState || !got.Remote {
+		t.Errorf("got %+v, want remote %+v", got, sc)
+	}
+
+	if id, _ := CorrelationIDFromContext(handled); id != "req-1" {
+		t.Errorf("got correlation ID %q, want req-1", id)
+	}
+}
+
+// childTracer starts spans with a new span ID in the trace of the parent.
+type childTracer struct {
+	started []SpanContext
+}
+
+func (t *childTracer) Start(ctx context.Context, _ string, _ SpanKind) (context.Context, Span) {
+	sc := NewSpanContext()
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		sc.TraceID = parent.TraceID
+	}
+
+	t.started = append(t.started, sc)
+
+	return ctx, childSpan{sc: sc}
+}
+
+type childSpan struct {
+	noopSpan
+	sc SpanContext
+}
+
+func (s childSpan) SpanContext() SpanContext {
+	return s.sc
+}
+
+func TestTracePropagatesProducerSpan(t *testing.T) {
+	tracer := &childTracer{}
+	c := &Client{tracer: tracer, propagator: TraceContext{}}
+
+	parent := NewSpanContext()
+	r := &kgo.Record{Topic: "bookings"}
+	c.injectTrace(ContextWithSpanContext(context.Background(), parent), r).End()
+
+	r.Context = context.Background()
+
+	var handled context.Context
+	c.traceMiddleware(func(r Record) { handled = r.Context })(r)
+
+	got, _ := SpanContextFromContext(handled)
+	if producer := tracer.started[0]; got.SpanID != producer.SpanID || got.TraceID != parent.TraceID {
+		t.Errorf("got consumed span context %+v, want producer span %+v in trace of the parent", got, producer)
+	}
+}
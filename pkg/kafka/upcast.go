@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+const (
+	// HeaderEventType holds the type of the event in the record value.
+	HeaderEventType = "event_type"
+	// HeaderEventVersion holds the schema version of the event in the record value. Records without it have version 1.
+	HeaderEventVersion = "event_version"
+
+	// cloudEventsVersionExtension is the CloudEvents extension holding the version in binary mode.
+	cloudEventsVersionExtension = "eventversion"
+
+	defaultEventVersion = 1
+)
+
+var ErrUnknownEventVersion = errors.New("unknown event version")
+
+// UnknownVersionError is returned for versions that cannot be upcast to the current version of the type,
+// either because they are newer than the current version or because an upcaster in the chain is missing.
+type UnknownVersionError struct {
+	Type    string
+	Version int
+	Current int
+}
+
+func (e *UnknownVersionError) Error() string {
+	return fmt.Sprintf("%s: version %d of %q cannot be upcast to current version %d",
+		ErrUnknownEventVersion, e.Version, e.Type, e.Current)
+}
+
+func (e *UnknownVersionError) Unwrap() error {
+	return ErrUnknownEventVersion
+}
+
+// Upcaster transforms the payload of an event from one version to the next.
+type Upcaster func(value []byte) ([]byte, error)
+
+type upcastStep struct {
+	eventType string
+	from      int
+}
+
+// Upcasters is a registry of upcasters keyed by event type and version. The current version of a type is one
+// above the highest version an upcaster is registered for.
+type Upcasters struct {
+	mu      sync.RWMutex
+	steps   map[upcastStep]Upcaster
+	current map[string]int
+}
+
+func NewUpcasters() *Upcasters {
+	return &Upcasters{
+		steps:   make(map[upcastStep]Upcaster),
+		current: make(map[string]int),
+	}
+}
+
+// Register adds an upcaster transforming events of the type from version from to version from+1.
+func (u *Upcasters) Register(eventType string, from int, fn Upcaster) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.steps[upcastStep{eventType: eventType, from: from}] = fn
+	if from+1 > u.current[eventType] {
+		u.current[eventType] = from + 1
+	}
+}
+
+// Current returns the current version of the type. Types without upcasters are at version 1.
+func (u *Upcasters) Current(eventType string) int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if current, ok := u.current[eventType]; ok {
+		return current
+	}
+
+	return defaultEventVersion
+}
+
+// Upcast applies the chain of upcasters from the given version to the current version of the type and returns
+// the payload and its version. Payloads of types without upcasters are returned unchanged.
+func (u *Upcasters) Upcast(eventType string, version int, value []byte) ([]byte, int, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	current, ok := u.current[eventType]
+	if !ok {
+		return value, version, nil
+	}
+
+	if version > current {
+		return nil, 0, &UnknownVersionError{Type: eventType, Version: version, Current: current}
+	}
+
+	for v := version; v < current; v++ {
+		fn, ok := u.steps[upcastStep{eventType: eventType, from: v}]
+		if !ok {
+			return nil, 0, &UnknownVersionError{Type: eventType, Version: v, Current: current}
+		}
+
+		var err error
+		if value, err = fn(value); err != nil {
+			return nil, 0, fmt.Errorf("upcast %q from version %d: %w", eventType, v, err)
+		}
+	}
+
+	return value, current, nil
+}
+
+// WithUpcasting upcasts consumed records to the current version before the handler is invoked and sets the version
+// header of produced records of known types without one to the current version.
+//
+// The event type is read from the event_type header, the version from the event_version header. For CloudEvents in
+// binary mode, the ce_type header and the eventversion extension are used instead. Records that cannot be upcast are
+// not passed to the handler; pull-style consumers receive them with the error, otherwise the error is reported to
+// the error handler.
+//
+// Register WithUpcasting before WithEncryption, WithClaimCheck and WithSignatureVerification. Middlewares registered
+// later run first on consumed records, so the upcasters see the plain payload.
+func WithUpcasting(u *Upcasters) Opt {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, u.intercept)
+		c.middlewares = append(c.middlewares, u.middleware(c))
+	}
+}
+
+func (u *Upcasters) intercept(_ context.Context, r Record) error {
+	eventType, versionKey, ok := eventTypeHeaders(r)
+	if !ok {
+		return nil
+	}
+
+	if _, ok := HeaderValue(r, versionKey); ok {
+		return nil
+	}
+
+	u.mu.RLock()
+	current, ok := u.current[eventType]
+	u.mu.RUnlock()
+
+	if ok {
+		SetHeader(r, versionKey, []byte(strconv.Itoa(current)))
+	}
+
+	return nil
+}
+
+func (u *Upcasters) middleware(c *Client) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(r Record) {
+			eventType, versionKey, ok := eventTypeHeaders(r)
+			if !ok {
+				next(r)
+				return
+			}
+
+			version := defaultEventVersion
+			if raw, ok := HeaderValue(r, versionKey); ok {
+				v, err := strconv.Atoi(string(raw))
+				if err != nil {
+					c.fail(r, fmt.Errorf("upcast: %s/%d@%d: invalid version %q", r.Topic, r.Partition, r.Offset, raw))
+					return
+				}
+				version = v
+			}
+
+			value, current, err := u.Upcast(eventType, version, r.Value)
+			if err != nil {
+				c.fail(r, fmt.Errorf("upcast: %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+				return
+			}
+
+			if current != version {
+				r.Value = value
+				SetHeader(r, versionKey, []byte(strconv.Itoa(current)))
+			}
+
+			next(r)
+		}
+	}
+}
+
+// eventTypeHeaders returns the event type of the record and the key of the header holding its version.
+func eventTypeHeaders(r Record) (string, string, bool) {
+	if eventType, ok := HeaderValue(r, HeaderEventType); ok {
+		return string(eventType), HeaderEventVersion, true
+	}
+
+	if eventType, ok := HeaderValue(r, CloudEventsHeaderPrefix+"type"); ok {
+		return string(eventType), CloudEventsHeaderPrefix + cloudEventsVersionExtension, true
+	}
+
+	return "", "", false
+}
+
+// JSONHandler returns a handler decoding the record value into T. Records that cannot be decoded are reported like
+// records a middleware fails to pass on. Combined with WithUpcasting, fn always receives the current version of T.
+func JSONHandler[T any](c *Client, fn func(r Record, v T)) HandlerFunc {
+	return func(r Record) {
+		var v T
+		if err := json.Unmarshal(r.Value, &v); err != nil {
+			c.fail(r, fmt.Errorf("decode %s/%d@%d: %w", r.Topic, r.Partition, r.Offset, err))
+			return
+		}
+
+		fn(r, v)
+	}
+}
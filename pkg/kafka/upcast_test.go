@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func renameField(from, to string) Upcaster {
+	return func(value []byte) ([]byte, error) {
+		return bytes.ReplaceAll(value, []byte(`"`+from+`"`), []byte(`"`+to+`"`)), nil
+	}
+}
+
+func TestUpcastChain(t *testing.T) {
+	u := NewUpcasters()
+	u.Register("booking.created", 1, renameField("room", "room_id"))
+	u.Register("booking.created", 2, renameField("room_id", "resource_id"))
+
+	if got := u.Current("booking.created"); got != 3 {
+		t.Errorf("got current version %d, want 3", got)
+	}
+
+	for version, value := range map[int]string{1: `{"room":7}`, 2: `{"room_id":7}`, 3: `{"resource_id":7}`} {
+		got, current, err := u.Upcast("booking.created", version, []byte(value))
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+
+		if current != 3 || string(got) != `{"resource_id":7}` {
+			t.Errorf("version %d: got %s at version %d, want {\"resource_id\":7} at version 3", version, got, current)
+		}
+	}
+
+	if got, _, err := u.Upcast("booking.deleted", 1, []byte("x")); err != nil || string(got) != "x" {
+		t.Errorf("got %q, %v for unregistered type, want unchanged payload", got, err)
+	}
+}
+
+func TestUpcastUnknownVersion(t *testing.T) {
+	u := NewUpcasters()
+	u.Register("booking.created", 2, renameField("room_id", "resource_id"))
+
+	for _, version := range []int{1, 4} {
+		_, _, err := u.Upcast("booking.created", version, []byte(`{}`))
+
+		var versionErr *UnknownVersionError
+		if !errors.As(err, &versionErr) || !errors.Is(err, ErrUnknownEventVersion) {
+			t.Fatalf("version %d: got error %v, want %T", version, err, versionErr)
+		}
+
+		if versionErr.Type != "booking.created" || versionErr.Current != 3 {
+			t.Errorf("version %d: got %+v", version, versionErr)
+		}
+	}
+}
+
+func TestUpcastMiddleware(t *testing.T) {
+	u := NewUpcasters()
+	u.Register("booking.created", 1, renameField("room", "room_id"))
+
+	var reported []error
+	c := &Client{onError: func(err error) { reported = append(reported, err) }}
+
+	type booking struct {
+		RoomID int `json:"room_id"`
+	}
+
+	var handled []int
+	handler := u.middleware(c)(JSONHandler(c, func(_ Record, b booking) {
+		handled = append(handled, b.RoomID)
+	}))
+
+	old := &kgo.Record{Value: []byte(`{"room":7}`)}
+	SetHeader(old, HeaderEventType, []byte("booking.created"))
+	handler(old)
+
+	current := &kgo.Record{Value: []byte(`{"room_id":8}`)}
+	SetHeader(current, HeaderEventType, []byte("booking.created"))
+	if err := u.intercept(context.Background(), current); err != nil {
+		t.Fatal(err)
+	}
+	handler(current)
+
+	future := &kgo.Record{Value: []byte(`{}`)}
+	SetHeader(future, HeaderEventType, []byte("booking.created"))
+	SetHeader(future, HeaderEventVersion, []byte("5"))
+	handler(future)
+
+	if len(handled) != 2 || handled[0] != 7 || handled[1] != 8 {
+		t.Errorf("got handled rooms %v, want [7 8]", handled)
+	}
+
+	if v, _ := HeaderValue(old, HeaderEventVersion); string(v) != "2" {
+		t.Errorf("got version header %q, want 2", v)
+	}
+
+	if len(reported) != 1 || !errors.Is(reported[0], ErrUnknownEventVersion) {
+		t.Errorf("got reported errors %v, want [%v]", reported, ErrUnknownEventVersion)
+	}
+}
+
+func TestUpcastEncryptedRecords(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewUpcasters()
+	u.Register("booking.created", 1, renameField("room", "room_id"))
+
+	// The options are registered in the documented order.
+	c := defaultClient()
+	c.onError = func(err error) { t.Error(err) }
+	for _, opt := range []Opt{WithUpcasting(u), WithEncryption(provider)} {
+		opt(c)
+	}
+
+	r := &kgo.Record{Topic: "bookings", Value: []byte(`{"room":7}`), Context: ctx}
+	SetHeader(r, HeaderEventType, []byte("booking.created"))
+	SetHeader(r, HeaderEventVersion, []byte("1"))
+
+	if _, err := c.intercept(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(r.Value, []byte("room")) {
+		t.Fatal("value not encrypted")
+	}
+
+	var got []byte
+	c.wrap(func(r Record) { got = r.Value })(r)
+
+	if string(got) != `{"room_id":7}` {
+		t.Errorf("got %s, want the upcast plain payload", got)
+	}
+}
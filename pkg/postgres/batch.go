@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrBatchNotSent = errors.New("batch not sent")
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+// BatchSender is implemented by Pool, pgx.Tx and pgx connections.
+type BatchSender interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// Batch queues statements that are sent in a single round-trip. Results are available from the futures returned
+// by the Queue functions once the batch was sent.
+type Batch struct {
+	batch pgx.Batch
+	items []batchItem
+}
+
+type batchItem struct {
+	resolve func(br pgx.BatchResults) error
+	fail    func(err error)
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Len returns the number of queued statements.
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+// Future holds the result of a queued statement.
+type Future[T any] struct {
+	value    T
+	err      error
+	resolved bool
+}
+
+// Get returns the result of the statement or ErrBatchNotSent if the batch was not sent yet.
+func (f *Future[T]) Get() (T, error) {
+	if !f.resolved {
+		var empty T
+		return empty, ErrBatchNotSent
+	}
+
+	return f.value, f.err
+}
+
+func queue[T any](b *Batch, collect func(br pgx.BatchResults) (T, error), sql string, args ...any) *Future[T] {
+	f := &Future[T]{}
+
+	b.batch.Queue(sql, args...)
+	b.items = append(b.items, batchItem{
+		resolve: func(br pgx.BatchResults) error {
+			f.value, f.err = collect(br)
+			f.err = wrapPgxError(f.err)
+			f.resolved = true
+
+			return f.err
+		},
+		fail: func(err error) {
+			f.err = err
+			f.resolved = true
+		},
+	})
+
+	return f
+}
+
+// QueueExec queues a statement and returns its command tag.
+func (b *Batch) QueueExec(sql string, args ...any) *Future[pgconn.CommandTag] {
+	return queue(b, func(br pgx.BatchResults) (pgconn.CommandTag, error) {
+		return br.Exec()
+	}, sql, args...)
+}
+
+// QueueRowsToStruct queues a query collecting its rows like CollectRowsToStruct.
+func QueueRowsToStruct[T any](b *Batch, sql string, args ...any) *Future[[]T] {
+	return queue(b, func(br pgx.BatchResults) ([]T, error) {
+		rows, _ := br.Query()
+		return pgx.CollectRows(rows, pgx.RowToStructByNameLax[T])
+	}, sql, args...)
+}
+
+// QueueOneRowToStruct queues a query collecting its row like CollectOneRowToStruct.
+func QueueOneRowToStruct[T any](b *Batch, sql string, args ...any) *Future[T] {
+	return queue(b, func(br pgx.BatchResults) (T, error) {
+		rows, _ := br.Query()
+		return collectOneRow(rows, pgx.RowToStructByNameLax[T])
+	}, sql, args...)
+}
+
+// QueueColumn queues a query collecting its single column like CollectColumn.
+func QueueColumn[T any](b *Batch, sql string, args ...any) *Future[[]T] {
+	return queue(b, func(br pgx.BatchResults) ([]T, error) {
+		rows, _ := br.Query()
+		return pgx.CollectRows(rows, pgx.RowTo[T])
+	}, sql, args...)
+}
+
+// QueueSingleValue queues a query collecting its single value like CollectSingleValue.
+func QueueSingleValue[T any](b *Batch, sql string, args ...any) *Future[T] {
+	return queue(b, func(br pgx.BatchResults) (T, error) {
+		rows, _ := br.Query()
+		return collectOneRow(rows, pgx.RowTo[T])
+	}, sql, args...)
+}
+
+// Send sends all queued statements in one round-trip and resolves their futures. Unless s is a transaction,
+// the statements run in an implicit transaction, so if one fails with a server error, the following ones are not
+// executed: their futures fail with ErrBatchAborted. Client-side errors, e.g. ErrTooManyRows or values that cannot
+// be scanned, only fail their own future. Send returns the error of the first failed statement.
+func (b *Batch) Send(ctx context.Context, s BatchSender) error {
+	br := s.SendBatch(ctx, &b.batch)
+
+	var firstErr, abortErr error
+	for _, item := range b.items {
+		if abortErr != nil {
+			item.fail(fmt.Errorf("%w: %w", ErrBatchAborted, abortErr))
+			continue
+		}
+
+		err := item.resolve(br)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			abortErr = err
+		}
+	}
+
+	if err := br.Close(); err != nil && firstErr == nil {
+		firstErr = wrapPgxError(err)
+	}
+
+	return firstErr
+}
+
+// SendBatch sends the batch in the transaction carried by the context (see ContextWithTx) or on the pool.
+// Use Batch.Send to get typed results.
+func (p *Pool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.SendBatch(ctx, b)
+	}
+
+	return p.pool.SendBatch(ctx, b)
+}
@@ -0,0 +1,228 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeResult is the result of one statement sent by fakeSender.
+type fakeResult struct {
+	columns []string
+	rows    [][]any
+	err     error
+}
+
+type fakeSender struct {
+	results []fakeResult
+	sent    int
+}
+
+func (s *fakeSender) SendBatch(_ context.Context, b *pgx.Batch) pgx.BatchResults {
+	s.sent = b.Len()
+	return &fakeBatchResults{results: s.results}
+}
+
+type fakeBatchResults struct {
+	results []fakeResult
+	next    int
+}
+
+func (br *fakeBatchResults) result() fakeResult {
+	r := br.results[br.next]
+	br.next++
+
+	return r
+}
+
+func (br *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	r := br.result()
+	if r.err != nil {
+		return pgconn.CommandTag{}, r.err
+	}
+
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", len(r.rows))), nil
+}
+
+func (br *fakeBatchResults) Query() (pgx.Rows, error) {
+	r := br.result()
+	rows := &fakeRows{result: r}
+
+	return rows, r.err
+}
+
+func (br *fakeBatchResults) QueryRow() pgx.Row {
+	rows, _ := br.Query()
+	return rows
+}
+
+func (br *fakeBatchResults) Close() error {
+	return nil
+}
+
+type fakeRows struct {
+	result  fakeResult
+	current int
+	closed  bool
+}
+
+func (r *fakeRows) Close() {
+	r.closed = true
+}
+
+func (r *fakeRows) Err() error {
+	return r.result.err
+}
+
+func (r *fakeRows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.result.rows)))
+}
+
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription {
+	fields := make([]pgconn.FieldDescription, len(r.result.columns))
+	for i, column := range r.result.columns {
+		fields[i].Name = column
+	}
+
+	return fields
+}
+
+func (r *fakeRows) Next() bool {
+	if r.closed || r.result.err != nil || r.current >= len(r.result.rows) {
+		r.closed = true
+		return false
+	}
+
+	r.current++
+
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.result.rows[r.current-1][i]))
+	}
+
+	return nil
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return r.result.rows[r.current-1], nil
+}
+
+func (r *fakeRows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *fakeRows) Conn() *pgx.Conn {
+	return nil
+}
+
+type batchAsset struct {
+	ID   int64
+	Name string
+}
+
+func TestBatchSend(t *testing.T) {
+	b := NewBatch()
+	updated := b.QueueExec("UPDATE assets SET name = name")
+	asset := QueueOneRowToStruct[batchAsset](b, "SELECT id, name FROM assets WHERE id = $1", 1)
+	names := QueueColumn[string](b, "SELECT name FROM assets")
+	count := QueueSingleValue[int64](b, "SELECT count(*) FROM assets")
+
+	if _, err := asset.Get(); !errors.Is(err, ErrBatchNotSent) {
+		t.Fatalf("got error %v before Send, want %v", err, ErrBatchNotSent)
+	}
+
+	s := &fakeSender{results: []fakeResult{
+		{rows: [][]any{{}, {}}},
+		{columns: []string{"id", "name"}, rows: [][]any{{int64(1), "boiler"}}},
+		{columns: []string{"name"}, rows: [][]any{{"boiler"}, {"pump"}}},
+		{columns: []string{"count"}, rows: [][]any{{int64(2)}}},
+	}}
+
+	if err := b.Send(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.sent != 4 {
+		t.Errorf("got %d statements sent, want 4", s.sent)
+	}
+
+	if tag, err := updated.Get(); err != nil || tag.RowsAffected() != 2 {
+		t.Errorf("got %v, %v, want 2 rows affected", tag, err)
+	}
+
+	if a, err := asset.Get(); err != nil || a != (batchAsset{ID: 1, Name: "boiler"}) {
+		t.Errorf("got %+v, %v, want the boiler", a, err)
+	}
+
+	if n, err := names.Get(); err != nil || !reflect.DeepEqual(n, []string{"boiler", "pump"}) {
+		t.Errorf("got %v, %v, want [boiler pump]", n, err)
+	}
+
+	if c, err := count.Get(); err != nil || c != 2 {
+		t.Errorf("got %d, %v, want 2", c, err)
+	}
+}
+
+func TestBatchSendServerErrorAborts(t *testing.T) {
+	b := NewBatch()
+	first := b.QueueExec("UPDATE assets SET name = name")
+	failed := b.QueueExec("INSERT INTO assets (id) VALUES (1)")
+	skipped := QueueSingleValue[int64](b, "SELECT count(*) FROM assets")
+
+	pgErr := &pgconn.PgError{Code: "23505", Message: "duplicate key"}
+	s := &fakeSender{results: []fakeResult{
+		{},
+		{err: pgErr},
+		{columns: []string{"count"}, rows: [][]any{{int64(1)}}},
+	}}
+
+	err := b.Send(context.Background(), s)
+
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) || queryErr.Code() != "23505" {
+		t.Fatalf("got error %v, want a query error with code 23505", err)
+	}
+
+	if _, err := first.Get(); err != nil {
+		t.Errorf("got error %v for the statement before the failure, want nil", err)
+	}
+
+	if _, err := failed.Get(); !errors.Is(err, pgErr) {
+		t.Errorf("got error %v for the failed statement, want %v", err, pgErr)
+	}
+
+	if _, err := skipped.Get(); !errors.Is(err, ErrBatchAborted) || !errors.Is(err, pgErr) {
+		t.Errorf("got error %v for the following statement, want %v wrapping %v", err, ErrBatchAborted, pgErr)
+	}
+}
+
+func TestBatchSendClientErrorContinues(t *testing.T) {
+	b := NewBatch()
+	tooMany := QueueSingleValue[string](b, "SELECT name FROM assets")
+	count := QueueSingleValue[int64](b, "SELECT count(*) FROM assets")
+
+	s := &fakeSender{results: []fakeResult{
+		{columns: []string{"name"}, rows: [][]any{{"boiler"}, {"pump"}}},
+		{columns: []string{"count"}, rows: [][]any{{int64(2)}}},
+	}}
+
+	if err := b.Send(context.Background(), s); !errors.Is(err, ErrTooManyRows) {
+		t.Fatalf("got error %v, want %v", err, ErrTooManyRows)
+	}
+
+	if _, err := tooMany.Get(); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("got error %v, want %v", err, ErrTooManyRows)
+	}
+
+	if c, err := count.Get(); err != nil || c != 2 {
+		t.Errorf("got %d, %v for the following statement, want 2", c, err)
+	}
+}
@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheLoader loads the value of a key, usually with a query.
+type CacheLoader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+type cacheConfig struct {
+	ttl time.Duration
+}
+
+type CacheOpt func(*cacheConfig)
+
+// WithCacheTTL expires entries after the given time, in case a notification is lost. Zero keeps entries until
+// they are invalidated.
+func WithCacheTTL(ttl time.Duration) CacheOpt {
+	return func(c *cacheConfig) {
+		c.ttl = ttl
+	}
+}
+
+type cacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func (e cacheEntry[V]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Cache keeps loaded values in memory and invalidates them when their key is notified on a channel, e.g. from
+// a trigger calling pg_notify('assets_changed', NEW.id::text). The payload is the key, either as JSON or, for
+// string keys, as plain text; an empty payload flushes the whole cache. The cache is flushed when the listener
+// reconnects, as notifications sent in the meantime are lost.
+//
+// Concurrent loads of the same key are merged into one. A value loaded while its key was invalidated is not cached.
+type Cache[K comparable, V any] struct {
+	load       CacheLoader[K, V]
+	listener   *Listener
+	ttl        time.Duration
+	mu         sync.RWMutex
+	entries    map[K]cacheEntry[V]
+	loads      map[K]*keyLoads
+	generation uint64
+	lastSweep  time.Time
+	group      singleflight.Group
+}
+
+// keyLoads tracks the loads of a key in flight. The generation is bumped when the key is invalidated, so loads
+// started before do not cache their value.
+type keyLoads struct {
+	active     int
+	generation uint64
+}
+
+// NewCache creates a cache that is invalidated by notifications on the channel of the listener.
+func NewCache[K comparable, V any](l *Listener, channel string, load CacheLoader[K, V], opts ...CacheOpt) *Cache[K, V] {
+	cfg := cacheConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	c := &Cache[K, V]{
+		load:     load,
+		listener: l,
+		ttl:      cfg.ttl,
+		entries:  make(map[K]cacheEntry[V]),
+		loads:    make(map[K]*keyLoads),
+	}
+
+	l.Subscribe(channel, c.handle)
+	l.OnReconnect(func(context.Context) {
+		c.Flush()
+	})
+
+	return c
+}
+
+// Get returns the cached value of the key or loads it. If the context is done before the load finished, Get
+// returns the error of the context while the load continues for other callers.
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if ok && !entry.expired(time.Now()) {
+		return entry.value, nil
+	}
+
+	ch := c.group.DoChan(flightKey(key), func() (any, error) {
+		c.mu.Lock()
+		generation := c.generation
+		loads, ok := c.loads[key]
+		if !ok {
+			loads = &keyLoads{}
+			c.loads[key] = loads
+		}
+		loads.active++
+		keyGeneration := loads.generation
+		c.mu.Unlock()
+
+		// Callers share the load, so one canceled caller must not fail the others.
+		value, err := c.load(context.WithoutCancel(ctx), key)
+
+		now := time.Now()
+
+		c.mu.Lock()
+		if err == nil && c.generation == generation && loads.generation == keyGeneration {
+			entry := cacheEntry[V]{value: value}
+			if c.ttl > 0 {
+				entry.expiresAt = now.Add(c.ttl)
+			}
+			c.entries[key] = entry
+		}
+
+		if loads.active--; loads.active == 0 {
+			delete(c.loads, key)
+		}
+
+		c.sweep(now)
+		c.mu.Unlock()
+
+		return value, err
+	})
+
+	select {
+	case res := <-ch:
+		value, _ := res.Val.(V)
+		return value, res.Err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Invalidate removes the key, so the next Get loads it again.
+func (c *Cache[K, V]) Invalidate(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	if loads, ok := c.loads[key]; ok {
+		loads.generation++
+	}
+	c.mu.Unlock()
+
+	c.group.Forget(flightKey(key))
+}
+
+// Flush removes all keys.
+func (c *Cache[K, V]) Flush() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// Len returns the number of cached keys, including expired ones that were not removed yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.entries)
+}
+
+// sweep removes expired entries, at most once per TTL, so keys that are not requested again do not pile up.
+// c.mu must be held.
+func (c *Cache[K, V]) sweep(now time.Time) {
+	if c.ttl <= 0 || now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+
+	maps.DeleteFunc(c.entries, func(_ K, entry cacheEntry[V]) bool {
+		return entry.expired(now)
+	})
+	c.lastSweep = now
+}
+
+func (c *Cache[K, V]) handle(channel string, payload string) {
+	if payload == "" {
+		c.Flush()
+		return
+	}
+
+	key, err := parseCacheKey[K](payload)
+	if err != nil {
+		// Flushing is safe when the changed key is unknown.
+		c.Flush()
+		c.listener.reportError(fmt.Errorf("cache: %q: invalid key %q: %w", channel, payload, err))
+		return
+	}
+
+	c.Invalidate(key)
+}
+
+func parseCacheKey[K comparable](payload string) (K, error) {
+	var key K
+
+	err := json.Unmarshal([]byte(payload), &key)
+	if err == nil {
+		return key, nil
+	}
+
+	if s, ok := any(&key).(*string); ok {
+		*s = payload
+		return key, nil
+	}
+
+	return key, err
+}
+
+func flightKey[K comparable](key K) string {
+	return fmt.Sprintf("%#v", key)
+}
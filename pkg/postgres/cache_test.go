@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLoader returns the key as value and counts the loads.
+func countingLoader(loads *atomic.Int32) CacheLoader[string, string] {
+	return func(_ context.Context, key string) (string, error) {
+		loads.Add(1)
+		return key, nil
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	ttl := 20 * time.Millisecond
+
+	var loads atomic.Int32
+	c := NewCache((&Pool{}).NewListener(), "assets", countingLoader(&loads), WithCacheTTL(ttl))
+
+	for range 2 {
+		if v, err := c.Get(ctx, "a"); err != nil || v != "a" {
+			t.Fatalf("got %q, %v, want a", v, err)
+		}
+	}
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("got %d loads within the TTL, want 1", n)
+	}
+
+	time.Sleep(ttl)
+
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := loads.Load(); n != 2 {
+		t.Errorf("got %d loads after the TTL, want 2", n)
+	}
+
+	// Loading another key after the TTL removes expired keys that are not requested again.
+	time.Sleep(ttl)
+
+	if _, err := c.Get(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c.Len(); n != 1 {
+		t.Errorf("got %d keys, want only the key loaded last", n)
+	}
+}
+
+func TestCacheInvalidateWhileLoading(t *testing.T) {
+	ctx := context.Background()
+	loading, release := make(chan struct{}), make(chan struct{})
+
+	var loads atomic.Int32
+	c := NewCache((&Pool{}).NewListener(), "assets", func(ctx context.Context, key string) (string, error) {
+		if loads.Add(1) == 1 {
+			close(loading)
+			<-release
+			return "stale", nil
+		}
+
+		return "fresh", nil
+	})
+
+	done := make(chan string)
+	go func() {
+		v, _ := c.Get(ctx, "a")
+		done <- v
+	}()
+
+	<-loading
+	c.handle("assets", `"a"`)
+	close(release)
+
+	if v := <-done; v != "stale" {
+		t.Errorf("got %q from the interrupted load, want stale", v)
+	}
+
+	// The value loaded while the key was invalidated is not cached.
+	if v, err := c.Get(ctx, "a"); err != nil || v != "fresh" {
+		t.Errorf("got %q, %v, want fresh", v, err)
+	}
+}
+
+func TestCacheFlushOnReconnect(t *testing.T) {
+	ctx := context.Background()
+	l := (&Pool{}).NewListener()
+
+	var loads atomic.Int32
+	c := NewCache(l, "assets", countingLoader(&loads))
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, fn := range l.onReconnect {
+		fn(ctx)
+	}
+
+	if n := c.Len(); n != 0 {
+		t.Errorf("got %d keys after reconnecting, want 0", n)
+	}
+}
+
+func TestCacheHandle(t *testing.T) {
+	ctx := context.Background()
+
+	var loads atomic.Int32
+	c := NewCache((&Pool{}).NewListener(), "assets", countingLoader(&loads))
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.handle("assets", "a")
+	if _, ok := c.entries["a"]; ok || c.Len() != 1 {
+		t.Errorf("got %d keys after invalidating a, want only b", c.Len())
+	}
+
+	c.handle("assets", "")
+	if n := c.Len(); n != 0 {
+		t.Errorf("got %d keys after an empty payload, want 0", n)
+	}
+}
+
+func TestCacheInvalidateOtherKeyWhileLoading(t *testing.T) {
+	ctx := context.Background()
+	loading, release := make(chan struct{}), make(chan struct{})
+
+	var loads atomic.Int32
+	c := NewCache((&Pool{}).NewListener(), "assets", func(ctx context.Context, key string) (string, error) {
+		if loads.Add(1) == 1 {
+			close(loading)
+			<-release
+		}
+
+		return key, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = c.Get(ctx, "a")
+	}()
+
+	<-loading
+	c.handle("assets", "b")
+	close(release)
+	<-done
+
+	// Invalidating another key does not discard the value.
+	if _, err := c.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("got %d loads, want 1", n)
+	}
+}
+
+func TestCacheGetCanceled(t *testing.T) {
+	loading, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	c := NewCache((&Pool{}).NewListener(), "assets", func(ctx context.Context, key string) (string, error) {
+		close(loading)
+		<-release
+		return key, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-loading
+		cancel()
+	}()
+
+	// The canceled caller returns while the load is still running.
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -30,19 +30,23 @@ type Pool struct {
 	asyncCommits          bool
 	resetOnAcquire        bool
 	overrideRole          string
+	anonymousRole         string
 	afterConnectFuncs     []func(ctx context.Context, conn *pgx.Conn) error
 	afterReleaseFuncs     []func(conn *pgx.Conn) bool
 	login                 string
 	password              string
 	database              string
+	txHooks               TxHooks
+	notifyOverflowTable   string
 }
 
 func defaultPool() *Pool {
 	hostname, _ := os.Hostname()
 
 	return &Pool{
-		maxPoolSize: 4,
-		appName:     hostname,
+		maxPoolSize:         4,
+		appName:             hostname,
+		notifyOverflowTable: defaultNotifyOverflowTable,
 	}
 }
 
@@ -82,7 +86,7 @@ func NewPool(ctx context.Context, opts ...Opt) (*Pool, error) {
 
 	if pool.overrideRole != "" {
 		pool.afterConnectFuncs = append(pool.afterConnectFuncs, func(ctx context.Context, conn *pgx.Conn) error {
-			_, execErr := conn.Exec(ctx, "SET ROLE "+pool.overrideRole)
+			_, execErr := conn.Exec(ctx, pool.setConnRoleSQL())
 			return execErr
 		})
 	}
@@ -155,64 +159,78 @@ func (p *Pool) Close(ctx context.Context) error {
 	return nil
 }
 
+// Exec runs the statement in the transaction carried by the context (see ContextWithTx) or on the pool.
 func (p *Pool) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		ct, err := tx.Exec(ctx, query, args...)
+
+		return ct, wrapPgxError(err)
+	}
+
 	ct, err := p.pool.Exec(ctx, query, args...)
 
 	return ct, wrapPgxError(err)
 }
 
+// Query runs the query in the transaction carried by the context (see ContextWithTx) or on the pool.
 func (p *Pool) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		rows, err := tx.Query(ctx, query, args...)
+
+		return rows, wrapPgxError(err)
+	}
+
 	rows, err := p.pool.Query(ctx, query, args...)
 
 	return rows, wrapPgxError(err)
 }
 
+// ExecAs runs the statement with the given role.
+//
+// Deprecated: use WithRole or TxAs.
 func (p *Pool) ExecAs(ctx context.Context, role string, query string, args ...interface{}) (pgconn.CommandTag, error) {
-	conn, err := p.AcquireConn(ctx)
-	if err != nil {
-		return pgconn.CommandTag{}, err
-	}
-
-	defer conn.Release()
-
-	_, err = conn.Exec(ctx, "SET ROLE "+role)
-	if err != nil {
-		return pgconn.CommandTag{}, err
-	}
-
-	ct, err := p.Exec(ctx, query, args...)
+	var ct pgconn.CommandTag
 
-	_, _ = conn.Exec(ctx, "RESET ROLE")
+	err := p.WithRole(ctx, role, func(conn *Conn) error {
+		var err error
+		ct, err = conn.Exec(ctx, query, args...)
 
-	if err != nil {
-		return pgconn.CommandTag{}, err
-	}
+		return err
+	})
 
-	return ct, nil
+	return ct, err
 }
 
+// QueryAs runs the query with the given role. The connection stays pinned to the role until the rows are closed
+// or fully read.
+//
+// Deprecated: use WithRole or TxAs.
 func (p *Pool) QueryAs(ctx context.Context, role string, query string, args ...interface{}) (pgx.Rows, error) {
-	conn, err := p.AcquireConn(ctx)
+	conn, err := p.acquireAs(ctx, role)
 	if err != nil {
 		return nil, err
 	}
 
-	defer conn.Release()
-
-	_, err = conn.Exec(ctx, "SET ROLE "+role)
+	rows, err := conn.Query(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		p.resetRole(ctx, conn)
+		return nil, wrapPgxError(err)
 	}
 
-	rows, err := p.Query(ctx, query, args...)
+	return &roleRows{Rows: rows, ctx: ctx, pool: p, conn: conn}, nil
+}
 
-	_, _ = conn.Exec(ctx, "RESET ROLE")
+// CopyFrom runs COPY in the transaction carried by the context (see ContextWithTx) or on the pool.
+func (p *Pool) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		n, err := tx.CopyFrom(ctx, table, columns, src)
 
-	if err != nil {
-		return nil, err
+		return n, wrapPgxError(err)
 	}
 
-	return rows, nil
+	n, err := p.pool.CopyFrom(ctx, table, columns, src)
+
+	return n, wrapPgxError(err)
 }
 
 // AcquireConn returns a lower-level connection. You must release it via .Release().
@@ -232,10 +250,20 @@ func (p *Pool) StdlibDB() *sql.DB {
 	return db
 }
 
+// Tx begins a transaction. If the context carries a transaction, a savepoint in it is returned instead.
 func (p *Pool) Tx(ctx context.Context) (pgx.Tx, error) {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Begin(ctx)
+	}
+
 	return p.pool.BeginTx(ctx, pgx.TxOptions{})
 }
 
+// Begin is the same as Tx. It makes the pool a Copier.
+func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	return p.Tx(ctx)
+}
+
 // SetCredentials updates login and password that will be used for connections of an already created pool.
 // All idle connections are reset and will be recreated with new credentials.
 // Already acquired connections are not affected.
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// testPool connects to the database in POSTGRES_TEST_DSN and skips the test if it is not set.
+func testPool(t *testing.T, opts ...Opt) *Pool {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	pool, err := NewPool(context.Background(), append([]Opt{WithDSN(dsn)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = pool.Close(context.Background())
+	})
+
+	return pool
+}
+
+// testRoles creates roles the test user can switch to and drops them when the test finished.
+func testRoles(t *testing.T, roles ...string) {
+	t.Helper()
+
+	ctx := context.Background()
+	admin := testPool(t)
+
+	for _, role := range roles {
+		_, _ = admin.Exec(ctx, "DROP ROLE IF EXISTS "+SanitizedIdentifier(role))
+		if _, err := admin.Exec(ctx, "CREATE ROLE "+SanitizedIdentifier(role)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := admin.Exec(ctx, "GRANT "+SanitizedIdentifier(role)+" TO CURRENT_USER"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, role := range roles {
+			_, _ = admin.Exec(context.Background(), "DROP ROLE IF EXISTS "+SanitizedIdentifier(role))
+		}
+	})
+}
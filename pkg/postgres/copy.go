@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Copier is implemented by Pool, pgx.Tx and pgx connections.
+type Copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// CopyResult reports how many rows CopyFromStructs inserted and updated.
+type CopyResult struct {
+	Inserted int64
+	Updated  int64
+}
+
+type copyConfig struct {
+	upsert          bool
+	ignoreConflicts bool
+	conflictColumns []string
+}
+
+type CopyOpt func(*copyConfig)
+
+// WithCopyUpsert copies the rows into a staging table and upserts them from there, updating existing rows with
+// the same values in the conflict columns. Within the rows, the last row for a key wins. At least one conflict
+// column is required.
+func WithCopyUpsert(conflictColumns ...string) CopyOpt {
+	return func(c *copyConfig) {
+		c.upsert = true
+		c.conflictColumns = conflictColumns
+	}
+}
+
+// WithCopyIgnoreConflicts copies the rows into a staging table and inserts them from there, keeping existing rows.
+// Without conflict columns, conflicts on any unique constraint are ignored.
+func WithCopyIgnoreConflicts(conflictColumns ...string) CopyOpt {
+	return func(c *copyConfig) {
+		c.ignoreConflicts = true
+		c.conflictColumns = conflictColumns
+	}
+}
+
+// CopyFromStructs bulk loads rows into the table with COPY. Columns are derived from the exported fields of T:
+// the db tag names the column, fields tagged db:"-" are skipped and fields of embedded structs are included.
+// Every other field needs a db tag, as CollectRowsToStruct matches untagged fields ignoring case and underscores,
+// so the column of a field like DeviceID is ambiguous. The table can be schema qualified, e.g. "eliona_app.readings".
+//
+// With WithCopyUpsert or WithCopyIgnoreConflicts, the rows are copied into a temporary staging table in a
+// transaction (a savepoint if q is a transaction) and merged into the table from there.
+func CopyFromStructs[T any](ctx context.Context, q Copier, table string, rows []T, opts ...CopyOpt) (CopyResult, error) {
+	cfg := copyConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	fields, err := structColumns(reflect.TypeFor[T]())
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.name
+	}
+
+	src := pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+		v := reflect.ValueOf(&rows[i]).Elem()
+
+		values := make([]any, len(fields))
+		for j, f := range fields {
+			values[j] = v.FieldByIndex(f.index).Interface()
+		}
+
+		return values, nil
+	})
+
+	identifier := pgx.Identifier(strings.Split(table, "."))
+
+	if !cfg.upsert && !cfg.ignoreConflicts {
+		n, err := q.CopyFrom(ctx, identifier, columns, src)
+		if err != nil {
+			return CopyResult{}, wrapPgxError(err)
+		}
+
+		return CopyResult{Inserted: n}, nil
+	}
+
+	// A unique name allows several copies in one transaction, as the table is only dropped on commit of the
+	// outermost transaction.
+	stagingTable := pgx.Identifier{"copy_staging_" + strconv.FormatUint(rand.Uint64(), 36)}
+	staging := stagingTable.Sanitize()
+
+	merge, err := mergeQuery(identifier.Sanitize(), staging, columns, cfg)
+	if err != nil {
+		return CopyResult{}, err
+	}
+
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return CopyResult{}, wrapPgxError(err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+	}()
+
+	_, err = tx.Exec(ctx, fmt.Sprintf("CREATE TEMPORARY TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP",
+		staging, identifier.Sanitize()))
+	if err != nil {
+		return CopyResult{}, wrapPgxError(err)
+	}
+
+	if _, err := tx.CopyFrom(ctx, stagingTable, columns, src); err != nil {
+		return CopyResult{}, wrapPgxError(err)
+	}
+
+	var result CopyResult
+	err = tx.QueryRow(ctx, merge).Scan(&result.Inserted, &result.Updated)
+	if err != nil {
+		return CopyResult{}, wrapPgxError(err)
+	}
+
+	if _, err := tx.Exec(ctx, "DROP TABLE "+staging); err != nil {
+		return CopyResult{}, wrapPgxError(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return CopyResult{}, wrapPgxError(err)
+	}
+
+	return result, nil
+}
+
+// mergeQuery inserts the rows of the staging table into the table and returns the number of inserted and
+// updated rows. xmax is 0 for inserted rows. Upserts need conflict columns, as ON CONFLICT DO UPDATE requires
+// a conflict target.
+func mergeQuery(table string, staging string, columns []string, cfg copyConfig) (string, error) {
+	if cfg.upsert && len(cfg.conflictColumns) == 0 {
+		return "", errors.New("copy: upsert without conflict columns")
+	}
+
+	cols := make([]string, len(columns))
+	for i, col := range columns {
+		cols[i] = SanitizedIdentifier(col)
+	}
+
+	conflict := make([]string, len(cfg.conflictColumns))
+	for i, col := range cfg.conflictColumns {
+		conflict[i] = SanitizedIdentifier(col)
+	}
+
+	target := ""
+	if len(conflict) > 0 {
+		target = " (" + strings.Join(conflict, ", ") + ")"
+	}
+
+	selectRows := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), staging)
+
+	var action string
+	if cfg.upsert {
+		var updates []string
+		for i, col := range cols {
+			if !slices.Contains(cfg.conflictColumns, columns[i]) {
+				updates = append(updates, col+" = EXCLUDED."+col)
+			}
+		}
+
+		if len(updates) > 0 {
+			action = "DO UPDATE SET " + strings.Join(updates, ", ")
+		}
+
+		// A single INSERT cannot update a row twice, so only the last row of every key is kept.
+		keys := strings.Join(conflict, ", ")
+		selectRows = fmt.Sprintf("SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s, ctid DESC",
+			keys, strings.Join(cols, ", "), staging, keys)
+	}
+
+	if action == "" {
+		action = "DO NOTHING"
+	}
+
+	return fmt.Sprintf(`
+		WITH merged AS (
+			INSERT INTO %s (%s) %s
+			ON CONFLICT%s %s
+			RETURNING (xmax = 0) AS inserted
+		)
+		SELECT count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted) FROM merged`,
+		table, strings.Join(cols, ", "), selectRows, target, action), nil
+}
+
+type structColumn struct {
+	name  string
+	index []int
+}
+
+// structColumns returns the columns of the struct type from the db tags of its fields.
+func structColumns(t reflect.Type) ([]structColumn, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("copy: %s is not a struct", t)
+	}
+
+	var columns []structColumn
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("db")
+		tag, _, _ = strings.Cut(tag, ",")
+
+		// Exported fields of embedded structs are included even if the struct type itself is unexported.
+		embedded := f.Anonymous && f.Type.Kind() == reflect.Struct && !hasTag
+		if (!f.IsExported() && !embedded) || tag == "-" {
+			continue
+		}
+
+		if embedded {
+			fields, err := structColumns(f.Type)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, col := range fields {
+				col.index = append([]int{i}, col.index...)
+				columns = append(columns, col)
+			}
+
+			continue
+		}
+
+		if tag == "" {
+			return nil, fmt.Errorf("copy: %s.%s has no db tag", t, f.Name)
+		}
+
+		columns = append(columns, structColumn{name: tag, index: []int{i}})
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("copy: %s has no columns", t)
+	}
+
+	return columns, nil
+}
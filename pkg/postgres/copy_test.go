@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type copyBase struct {
+	ID int64 `db:"id"`
+}
+
+type copyReading struct {
+	copyBase
+	DeviceID string    `db:"device_id"`
+	Value    float64   `db:"value,omitempty"`
+	Internal string    `db:"-"`
+	Time     time.Time `db:"ts"`
+	note     string
+}
+
+func TestStructColumns(t *testing.T) {
+	columns, err := structColumns(reflect.TypeFor[copyReading]())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []structColumn{
+		{name: "id", index: []int{0, 0}},
+		{name: "device_id", index: []int{1}},
+		{name: "value", index: []int{2}},
+		{name: "ts", index: []int{4}},
+	}
+
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("got columns %+v, want %+v", columns, want)
+	}
+}
+
+func TestStructColumnsErrors(t *testing.T) {
+	type untagged struct {
+		DeviceID string
+	}
+
+	type ignored struct {
+		Value string `db:"-"`
+	}
+
+	tests := []struct {
+		t    reflect.Type
+		want string
+	}{
+		{reflect.TypeFor[untagged](), "DeviceID has no db tag"},
+		{reflect.TypeFor[ignored](), "has no columns"},
+		{reflect.TypeFor[string](), "is not a struct"},
+	}
+
+	for _, tt := range tests {
+		if _, err := structColumns(tt.t); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got error %v for %s, want %q", err, tt.t, tt.want)
+		}
+	}
+}
+
+func TestMergeQuery(t *testing.T) {
+	columns := []string{"device_id", "ts", "value"}
+
+	tests := []struct {
+		name    string
+		cfg     copyConfig
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "upsert",
+			cfg:  copyConfig{upsert: true, conflictColumns: []string{"device_id", "ts"}},
+			want: []string{
+				`SELECT DISTINCT ON ("device_id", "ts") "device_id", "ts", "value" FROM "staging" ORDER BY "device_id", "ts", ctid DESC`,
+				`ON CONFLICT ("device_id", "ts") DO UPDATE SET "value" = EXCLUDED."value"`,
+			},
+		},
+		{
+			name: "upsert without values",
+			cfg:  copyConfig{upsert: true, conflictColumns: columns},
+			want: []string{`ON CONFLICT ("device_id", "ts", "value") DO NOTHING`},
+		},
+		{
+			name:    "upsert without conflict columns",
+			cfg:     copyConfig{upsert: true},
+			wantErr: true,
+		},
+		{
+			name: "ignore conflicts",
+			cfg:  copyConfig{ignoreConflicts: true},
+			want: []string{
+				`INSERT INTO "readings" ("device_id", "ts", "value") SELECT "device_id", "ts", "value" FROM "staging"`,
+				`ON CONFLICT DO NOTHING`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := mergeQuery(`"readings"`, `"staging"`, columns, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(query, want) {
+					t.Errorf("got query %s, want it to contain %s", query, want)
+				}
+			}
+		})
+	}
+}
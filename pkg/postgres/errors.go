@@ -63,7 +63,9 @@ func wrapPgxError(err error) error {
 	var pgxErr *pgconn.PgError
 	if errors.As(err, &pgxErr) {
 		return &QueryError{
-			origin: err,
+			origin:  err,
+			code:    pgxErr.Code,
+			message: pgxErr.Message,
 		}
 	}
 
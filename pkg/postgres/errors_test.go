@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestWrapPgxError(t *testing.T) {
+	if err := wrapPgxError(nil); err != nil {
+		t.Errorf("got %v for nil, want nil", err)
+	}
+
+	pgErr := &pgconn.PgError{Code: "23505", Message: "duplicate key"}
+
+	var queryErr *QueryError
+	if err := wrapPgxError(pgErr); !errors.As(err, &queryErr) || queryErr.Code() != "23505" || !errors.Is(err, pgErr) {
+		t.Errorf("got %v, want a query error with code 23505 wrapping the server error", err)
+	}
+
+	var connErr *ConnectionError
+	if err := wrapPgxError(&pgconn.ConnectError{}); !errors.As(err, &connErr) {
+		t.Errorf("got %T, want a connection error", err)
+	}
+
+	var cfgErr *ConfigParserError
+	if err := wrapPgxError(&pgconn.ParseConfigError{}); !errors.As(err, &cfgErr) {
+		t.Errorf("got %T, want a config parser error", err)
+	}
+
+	unknown := errors.New("unknown")
+	if err := wrapPgxError(unknown); err != unknown {
+		t.Errorf("got %v, want the error unchanged", err)
+	}
+}
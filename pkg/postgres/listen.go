@@ -4,93 +4,307 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultReconnectDelay   = 10 * time.Second
+	listenerErrorBufferSize = 16
 )
 
 type Handler func(channel string, payload string)
 
+// Listener receives notifications on a dedicated connection outside the pool. Channels can be subscribed and
+// unsubscribed while it runs. If the connection is lost, the listener reports the error, reconnects after
+// ReconnectDelay and listens on all subscribed channels again.
 type Listener struct {
+	// ReconnectDelay is the time to wait before reconnecting. Defaults to 10 seconds, a negative value
+	// reconnects immediately.
 	ReconnectDelay time.Duration
-	db             *pgxpool.Pool
+	pool           *Pool
+	mu             sync.Mutex
 	handlers       map[string]Handler
+	wake           chan struct{}
+	errors         chan error
+	onError        func(error)
+	onReconnect    []func(ctx context.Context)
 }
 
-func (p *Pool) NewListener() *Listener {
-	return &Listener{
-		db: p.pool,
+type ListenerOpt func(*Listener)
+
+// WithListenerErrorHandler sets a function called with connection and LISTEN errors. Errors are also sent
+// to the channel returned by Errors.
+func WithListenerErrorHandler(fn func(error)) ListenerOpt {
+	return func(l *Listener) {
+		l.onError = fn
 	}
 }
 
-func (l *Listener) Handle(channel string, handler Handler) {
-	if l.handlers == nil {
-		l.handlers = make(map[string]Handler)
+// WithListenerReconnectDelay sets the time to wait before reconnecting, see Listener.ReconnectDelay.
+func WithListenerReconnectDelay(d time.Duration) ListenerOpt {
+	return func(l *Listener) {
+		l.ReconnectDelay = d
+	}
+}
+
+// WithOnReconnect adds a function called after the listener reconnected and listens again, see OnReconnect.
+func WithOnReconnect(fn func(ctx context.Context)) ListenerOpt {
+	return func(l *Listener) {
+		l.onReconnect = append(l.onReconnect, fn)
+	}
+}
+
+func (p *Pool) NewListener(opts ...ListenerOpt) *Listener {
+	l := &Listener{
+		ReconnectDelay: defaultReconnectDelay,
+		pool:           p,
+		handlers:       make(map[string]Handler),
+		wake:           make(chan struct{}, 1),
+		errors:         make(chan error, listenerErrorBufferSize),
+	}
+
+	for _, opt := range opts {
+		opt(l)
 	}
 
+	return l
+}
+
+// Handle registers the handler for the channel.
+//
+// Deprecated: use Subscribe.
+func (l *Listener) Handle(channel string, handler Handler) {
+	l.Subscribe(channel, handler)
+}
+
+// Subscribe listens on the channel and calls the handler for its notifications, replacing any previous handler.
+// It can be called before or while the listener runs.
+func (l *Listener) Subscribe(channel string, handler Handler) {
+	l.mu.Lock()
 	l.handlers[channel] = handler
+	l.mu.Unlock()
+
+	l.notify()
 }
 
-func (l *Listener) Listen(ctx context.Context, channel string, handler Handler) error {
-	if l.handlers == nil {
-		return errors.New("listener: no handlers defined")
+// Unsubscribe stops listening on the channel.
+func (l *Listener) Unsubscribe(channel string) {
+	l.mu.Lock()
+	delete(l.handlers, channel)
+	l.mu.Unlock()
+
+	l.notify()
+}
+
+// OnReconnect adds a function called after the listener reconnected and listens again. Notifications sent
+// while it was disconnected are lost, so use it to resync state.
+func (l *Listener) OnReconnect(fn func(ctx context.Context)) {
+	l.mu.Lock()
+	l.onReconnect = append(l.onReconnect, fn)
+	l.mu.Unlock()
+}
+
+// notify interrupts waiting for notifications, so the running listener updates its channels.
+func (l *Listener) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
 	}
+}
+
+// Errors returns a channel receiving connection and LISTEN errors. Errors are dropped if the channel is full.
+func (l *Listener) Errors() <-chan error {
+	return l.errors
+}
 
-	reconnectDelay := 10 * time.Second
-	if l.ReconnectDelay != 0 {
-		reconnectDelay = l.ReconnectDelay
+// Listen subscribes the handler to the channel, if given, and runs the listener.
+//
+// Deprecated: use Subscribe and Run.
+func (l *Listener) Listen(ctx context.Context, channel string, handler Handler) error {
+	if channel != "" && handler != nil {
+		l.Subscribe(channel, handler)
 	}
 
+	return l.Run(ctx)
+}
+
+// Run receives notifications until the context is canceled. Handlers are called one after another from the
+// goroutine calling Run.
+func (l *Listener) Run(ctx context.Context) error {
+	connected := false
+
 	for {
-		err := l.listen(ctx)
-		if err != nil {
-			// TODO: send error to err chan
+		err := l.listen(ctx, &connected)
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		if reconnectDelay < 0 {
-			if err := ctx.Err(); err != nil {
-				return err
-			}
+		l.reportError(err)
 
+		if l.ReconnectDelay < 0 {
 			continue
 		}
 
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(reconnectDelay):
-
+		case <-time.After(l.ReconnectDelay):
 		}
 	}
 }
 
-func (l *Listener) listen(ctx context.Context) error {
-	conn, err := l.db.Acquire(ctx)
+func (l *Listener) reportError(err error) {
+	if l.onError != nil {
+		l.onError(err)
+	}
+
+	select {
+	case l.errors <- err:
+	default:
+	}
+}
+
+// listen runs a session on a new connection. connected tracks whether any session listened before, so
+// onReconnect is only called for later sessions.
+func (l *Listener) listen(ctx context.Context, connected *bool) error {
+	conn, err := l.pool.connect(ctx)
 	if err != nil {
 		return fmt.Errorf("listener: connect: %w", err)
 	}
 
 	defer func() {
-		_ = conn.Conn().Close(ctx)
-		conn.Release()
+		_ = conn.Close(context.WithoutCancel(ctx))
 	}()
 
-	for channel := range l.handlers {
-		_, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
-		if err != nil {
-			return fmt.Errorf("listener: listen %q: %w", channel, err)
+	listening := make(map[string]bool)
+
+	for synced := false; ; synced = true {
+		if err := l.sync(ctx, conn, listening); err != nil {
+			return err
 		}
-	}
 
-	for {
-		notification, err := conn.Conn().WaitForNotification(ctx)
+		if !synced {
+			if *connected {
+				l.mu.Lock()
+				hooks := slices.Clone(l.onReconnect)
+				l.mu.Unlock()
+
+				for _, fn := range hooks {
+					fn(ctx)
+				}
+			}
+
+			*connected = true
+		}
+
+		notification, err := l.wait(ctx, conn)
 		if err != nil {
 			return fmt.Errorf("listener: wait for notification: %w", err)
 		}
 
-		if handler, ok := l.handlers[notification.Channel]; ok {
+		if notification == nil {
+			continue
+		}
+
+		l.mu.Lock()
+		handler, ok := l.handlers[notification.Channel]
+		l.mu.Unlock()
+
+		if ok {
 			handler(notification.Channel, notification.Payload)
 		}
 	}
 }
+
+// sync listens on subscribed channels and unlistens from unsubscribed ones.
+func (l *Listener) sync(ctx context.Context, conn *pgx.Conn, listening map[string]bool) error {
+	l.mu.Lock()
+	subscribed := make(map[string]bool, len(l.handlers))
+	for channel := range l.handlers {
+		subscribed[channel] = true
+	}
+	l.mu.Unlock()
+
+	for channel := range subscribed {
+		if listening[channel] {
+			continue
+		}
+
+		if _, err := conn.Exec(ctx, "LISTEN "+SanitizedIdentifier(channel)); err != nil {
+			return fmt.Errorf("listener: listen %q: %w", channel, wrapPgxError(err))
+		}
+
+		listening[channel] = true
+	}
+
+	for channel := range listening {
+		if subscribed[channel] {
+			continue
+		}
+
+		if _, err := conn.Exec(ctx, "UNLISTEN "+SanitizedIdentifier(channel)); err != nil {
+			return fmt.Errorf("listener: unlisten %q: %w", channel, wrapPgxError(err))
+		}
+
+		delete(listening, channel)
+	}
+
+	return nil
+}
+
+// wait waits for the next notification. It returns nil without error if it was interrupted by a change of
+// subscriptions.
+func (l *Listener) wait(ctx context.Context, conn *pgx.Conn) (*pgconn.Notification, error) {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	interrupted := make(chan struct{})
+	go func() {
+		select {
+		case <-l.wake:
+			close(interrupted)
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	n, err := conn.WaitForNotification(waitCtx)
+	if err == nil {
+		return n, nil
+	}
+
+	select {
+	case <-interrupted:
+		if ctx.Err() == nil && !conn.IsClosed() {
+			return nil, nil
+		}
+	default:
+	}
+
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return nil, err
+}
+
+// connect opens a connection with the configuration of the pool that is not managed by the pool.
+func (p *Pool) connect(ctx context.Context) (*pgx.Conn, error) {
+	cfg := p.pool.Config().ConnConfig.Copy()
+
+	if p.allowCredentialChange {
+		p.credMu.Lock()
+		cfg.User = p.login
+		cfg.Password = p.password
+		p.credMu.Unlock()
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+
+	return conn, wrapPgxError(err)
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const listenTestTimeout = 10 * time.Second
+
+func TestListenerSubscribe(t *testing.T) {
+	pool := testPool(t)
+	l := pool.NewListener()
+
+	first, second := make(chan string, 16), make(chan string, 16)
+	l.Subscribe("frm_test_first", func(_ string, payload string) { first <- payload })
+
+	runListener(t, l)
+	notifyUntilReceived(t, pool, "frm_test_first", first)
+
+	// Channels can be added and removed while the listener runs.
+	l.Subscribe("frm_test_second", func(_ string, payload string) { second <- payload })
+	notifyUntilReceived(t, pool, "frm_test_second", second)
+
+	l.Unsubscribe("frm_test_first")
+
+	// Notifications of a session arrive in order, so once the marker arrived, the first channel would have been
+	// delivered too. It may take a few attempts until the listener unlistened.
+	deadline := time.After(listenTestTimeout)
+	for {
+		drain(first)
+		notify(t, pool, "frm_test_first", "after unsubscribe")
+		notifyUntilReceived(t, pool, "frm_test_second", second)
+
+		select {
+		case <-first:
+		default:
+			return
+		}
+
+		select {
+		case <-deadline:
+			t.Fatal("still received notifications after Unsubscribe")
+		default:
+		}
+	}
+}
+
+func TestListenerReconnect(t *testing.T) {
+	pool := testPool(t)
+
+	reconnected := make(chan struct{}, 1)
+	l := pool.NewListener(
+		WithListenerReconnectDelay(10*time.Millisecond),
+		WithOnReconnect(func(context.Context) {
+			reconnected <- struct{}{}
+		}),
+	)
+
+	received := make(chan string, 16)
+	l.Subscribe("frm_test_reconnect", func(_ string, payload string) { received <- payload })
+
+	runListener(t, l)
+	notifyUntilReceived(t, pool, "frm_test_reconnect", received)
+
+	_, err := pool.Exec(context.Background(), `
+		SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid() AND query = 'LISTEN "frm_test_reconnect"'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-l.Errors():
+		if err == nil {
+			t.Error("got nil error after the connection was terminated")
+		}
+	case <-time.After(listenTestTimeout):
+		t.Fatal("no error reported after the connection was terminated")
+	}
+
+	select {
+	case <-reconnected:
+	case <-time.After(listenTestTimeout):
+		t.Fatal("OnReconnect not called")
+	}
+
+	notifyUntilReceived(t, pool, "frm_test_reconnect", received)
+}
+
+// runListener runs the listener until the test finished.
+func runListener(t *testing.T, l *Listener) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_ = l.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func notify(t *testing.T, pool *Pool, channel, payload string) {
+	t.Helper()
+
+	if _, err := pool.Exec(context.Background(), "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// notifyUntilReceived notifies the channel until the payload arrives, as notifications sent before the listener
+// listens are lost.
+func notifyUntilReceived(t *testing.T, pool *Pool, channel string, received <-chan string) {
+	t.Helper()
+
+	deadline := time.After(listenTestTimeout)
+	payload := time.Now().String()
+
+	for {
+		notify(t, pool, channel, payload)
+
+		select {
+		case got := <-received:
+			if got == payload {
+				return
+			}
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("no notification received on %q", channel)
+		}
+	}
+}
+
+func drain(ch <-chan string) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
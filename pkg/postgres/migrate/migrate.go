@@ -0,0 +1,478 @@
+// Package migrate runs versioned SQL migrations embedded in a service.
+//
+// Migrations are pairs of files named <version>_<name>.up.sql and <version>_<name>.down.sql, e.g.
+// 0001_create_bookings.up.sql. Down files are optional. Every migration runs in its own transaction and is
+// recorded with a checksum of its up file in the schema_migrations table.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/log"
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultDir   = "."
+	defaultTable = "schema_migrations"
+)
+
+var (
+	ErrNoDownMigration  = errors.New("no down migration")
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	ErrNotInitialized   = errors.New("migration table does not exist")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// ChecksumError is returned if the up file of an applied migration was changed afterwards.
+type ChecksumError struct {
+	Version  int64
+	Name     string
+	Applied  string
+	Embedded string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("migration %d_%s was changed after it was applied: checksum %s, applied %s",
+		e.Version, e.Name, e.Embedded, e.Applied)
+}
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is a migration together with the time it was applied, which is zero for pending migrations.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	pool       *postgres.Pool
+	logger     log.Logger
+	dir        string
+	schema     string
+	table      string
+	dryRun     bool
+	migrations []Migration
+}
+
+type Opt func(*Migrator)
+
+// WithDir sets the directory of the migrations in the file system. Defaults to the root.
+func WithDir(dir string) Opt {
+	return func(m *Migrator) {
+		m.dir = dir
+	}
+}
+
+// WithSchema runs the migrations and keeps their state in the schema, which is created if needed. Unqualified
+// names in the migrations refer to the schema, or to public if the schema has no such object. Use it for apps
+// owning a schema of the Eliona database.
+func WithSchema(schema string) Opt {
+	return func(m *Migrator) {
+		m.schema = schema
+	}
+}
+
+// WithTable sets the table recording applied migrations. Defaults to schema_migrations.
+func WithTable(table string) Opt {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithDryRun logs the migrations that would be applied or rolled back without changing the database.
+func WithDryRun() Opt {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+func WithLogger(l log.Logger) Opt {
+	return func(m *Migrator) {
+		m.logger = l
+	}
+}
+
+// New reads the migrations from the file system, usually an embed.FS.
+func New(pool *postgres.Pool, fsys fs.FS, opts ...Opt) (*Migrator, error) {
+	m := &Migrator{
+		pool:   pool,
+		logger: log.NoopLogger(),
+		dir:    defaultDir,
+		table:  defaultTable,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	migrations, err := load(fsys, m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m.migrations = migrations
+
+	return m, nil
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read %q: %w", dir, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: version of %q: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %q: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		}
+
+		if mig.Name != match[2] {
+			return nil, fmt.Errorf("migrate: %w %d: %q and %q", ErrDuplicateVersion, version, mig.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			mig.Up = string(content)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrate: migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+
+		migrations = append(migrations, *mig)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return migrations, nil
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// Up applies all pending migrations in order and returns them. Concurrent instances wait for each other, so only
+// one of them applies the migrations. Nothing is applied if an applied migration was changed (see ChecksumError).
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(conn *pgxpool.Conn, state map[int64]appliedMigration) error {
+		if err := m.verify(state); err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := state[mig.Version]; ok {
+				continue
+			}
+
+			if err := m.run(ctx, conn, mig, mig.Up, true); err != nil {
+				return err
+			}
+
+			applied = append(applied, mig)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+
+	err := m.locked(ctx, func(conn *pgxpool.Conn, state map[int64]appliedMigration) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := state[mig.Version]; !ok {
+				continue
+			}
+
+			if mig.Down == "" {
+				return fmt.Errorf("migrate: %w for %d_%s", ErrNoDownMigration, mig.Version, mig.Name)
+			}
+
+			if err := m.run(ctx, conn, mig, mig.Down, false); err != nil {
+				return err
+			}
+
+			rolledBack = append(rolledBack, mig)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status returns all embedded migrations with the time they were applied. It only reads the migration table,
+// without waiting for running migrations. If the table does not exist, all migrations are returned as pending
+// together with ErrNotInitialized.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.AcquireConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: acquire connection: %w", err)
+	}
+
+	defer conn.Release()
+
+	state, err := m.applied(ctx, conn)
+	if err != nil && !errors.Is(err, ErrNotInitialized) {
+		return nil, err
+	}
+
+	status := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status = append(status, Status{Migration: mig, AppliedAt: state[mig.Version].appliedAt})
+	}
+
+	return status, err
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) verify(state map[int64]appliedMigration) error {
+	embedded := make(map[int64]bool, len(m.migrations))
+
+	for _, mig := range m.migrations {
+		embedded[mig.Version] = true
+
+		applied, ok := state[mig.Version]
+		if ok && applied.checksum != mig.Checksum {
+			return &ChecksumError{Version: mig.Version, Name: mig.Name, Applied: applied.checksum, Embedded: mig.Checksum}
+		}
+	}
+
+	for version, applied := range state {
+		if !embedded[version] {
+			m.logger.Warn().Int64("version", version).Str("name", applied.name).Msg("applied migration is not embedded")
+		}
+	}
+
+	return nil
+}
+
+// locked runs fn on a connection holding the advisory lock of the migration table with the applied migrations.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn, state map[int64]appliedMigration) error) error {
+	conn, err := m.pool.AcquireConn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: acquire connection: %w", err)
+	}
+
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", m.lockKey()); err != nil {
+		return fmt.Errorf("migrate: lock: %w", err)
+	}
+
+	defer func() {
+		unlockCtx := context.WithoutCancel(ctx)
+		if _, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", m.lockKey()); err != nil {
+			// Closing the session releases the lock.
+			_ = conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	if !m.dryRun {
+		if err := m.createTable(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	// In a dry run, the table may not exist yet.
+	state, err := m.applied(ctx, conn)
+	if err != nil && !errors.Is(err, ErrNotInitialized) {
+		return err
+	}
+
+	return fn(conn, state)
+}
+
+// lockKey derives the advisory lock key from the migration table, so migrations of different schemas run
+// concurrently.
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("migrate:" + m.qualifiedTable()))
+
+	return int64(h.Sum64())
+}
+
+func (m *Migrator) qualifiedTable() string {
+	if m.schema == "" {
+		return postgres.SanitizedIdentifier(m.table)
+	}
+
+	return pgx.Identifier{m.schema, m.table}.Sanitize()
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *pgxpool.Conn) error {
+	if m.schema != "" {
+		if _, err := conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+postgres.SanitizedIdentifier(m.schema)); err != nil {
+			return fmt.Errorf("migrate: create schema: %w", err)
+		}
+	}
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version    bigint      PRIMARY KEY,
+			name       text        NOT NULL,
+			checksum   text        NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`, m.qualifiedTable()))
+	if err != nil {
+		return fmt.Errorf("migrate: create table: %w", err)
+	}
+
+	return nil
+}
+
+// applied returns the applied migrations, or ErrNotInitialized with no migrations if the table does not exist.
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedMigration, error) {
+	state := make(map[int64]appliedMigration)
+
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", m.qualifiedTable()).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migrate: check table: %w", err)
+	}
+
+	if !exists {
+		return state, fmt.Errorf("migrate: %s: %w", m.qualifiedTable(), ErrNotInitialized)
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %s", m.qualifiedTable()))
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read applied migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version int64
+			a       appliedMigration
+		)
+
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("migrate: read applied migrations: %w", err)
+		}
+
+		state[version] = a
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("migrate: read applied migrations: %w", err)
+	}
+
+	return state, nil
+}
+
+// run executes the SQL of the migration and records it in a single transaction.
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, mig Migration, sql string, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+
+	logger := m.logger.Info().Int64("version", mig.Version).Str("name", mig.Name).Str("direction", direction)
+
+	if m.dryRun {
+		logger.Str("sql", sql).Msg("dry run: skip migration")
+		return nil
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: begin: %w", err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+	}()
+
+	if m.schema != "" {
+		// public stays on the path for extensions and shared objects the migrations refer to.
+		_, err := tx.Exec(ctx, "SET LOCAL search_path TO "+postgres.SanitizedIdentifier(m.schema)+", public")
+		if err != nil {
+			return fmt.Errorf("migrate: set search path: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("migrate: %s %d_%s: %w", direction, mig.Version, mig.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES ($1, $2, $3)", m.qualifiedTable()),
+			mig.Version, mig.Name, mig.Checksum)
+	} else {
+		_, err = tx.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.qualifiedTable()), mig.Version)
+	}
+
+	if err != nil {
+		return fmt.Errorf("migrate: record %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("migrate: commit %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	logger.Msg("applied migration")
+
+	return nil
+}
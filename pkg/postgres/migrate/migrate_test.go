@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/postgres"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_room.up.sql":          {Data: []byte("ALTER TABLE bookings ADD room int;")},
+		"migrations/0002_add_room.down.sql":        {Data: []byte("ALTER TABLE bookings DROP room;")},
+		"migrations/0001_create_bookings.up.sql":   {Data: []byte("CREATE TABLE bookings (id int);")},
+		"migrations/0001_create_bookings.down.sql": {Data: []byte("DROP TABLE bookings;")},
+		"migrations/README.md":                     {Data: []byte("ignored")},
+	}
+
+	migrations, err := load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "add_room" {
+		t.Fatalf("got migrations %+v", migrations)
+	}
+
+	if migrations[0].Down != "DROP TABLE bookings;" || len(migrations[0].Checksum) != 64 {
+		t.Errorf("got migration %+v", migrations[0])
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing up": {
+			"0001_create_bookings.down.sql": {Data: []byte("DROP TABLE bookings;")},
+		},
+		"duplicate version": {
+			"0001_create_bookings.up.sql": {Data: []byte("CREATE TABLE bookings (id int);")},
+			"0001_create_rooms.up.sql":    {Data: []byte("CREATE TABLE rooms (id int);")},
+		},
+	}
+
+	for name, fsys := range tests {
+		if _, err := load(fsys, "."); err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	m := &Migrator{migrations: []Migration{{Version: 1, Name: "create_bookings", Checksum: "new"}}}
+
+	err := m.verify(map[int64]appliedMigration{1: {name: "create_bookings", checksum: "old"}})
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Version != 1 {
+		t.Errorf("got error %v, want %T", err, checksumErr)
+	}
+}
+
+// testPool connects to the database in POSTGRES_TEST_DSN and skips the test if it is not set.
+func testPool(t *testing.T) *postgres.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	pool, err := postgres.NewPool(context.Background(), postgres.WithDSN(dsn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), "DROP SCHEMA IF EXISTS frm_test_migrate CASCADE")
+		_, _ = pool.Exec(context.Background(), "DROP TABLE IF EXISTS public.frm_test_shared")
+		_ = pool.Close(context.Background())
+	})
+
+	return pool
+}
+
+func TestStatusNotInitialized(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	fsys := fstest.MapFS{"0001_create_bookings.up.sql": {Data: []byte("CREATE TABLE bookings (id int);")}}
+
+	m, err := New(pool, fsys, WithSchema("frm_test_migrate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.Status(ctx)
+	if !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("got error %v, want %v", err, ErrNotInitialized)
+	}
+
+	if len(status) != 1 || !status[0].AppliedAt.IsZero() {
+		t.Errorf("got status %+v, want one pending migration", status)
+	}
+
+	exists, err := postgres.CollectSingleValue[bool](ctx, pool, "SELECT to_regnamespace('frm_test_migrate') IS NOT NULL")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
+		t.Error("Status created the schema")
+	}
+}
+
+func TestUpWithSchema(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	if _, err := pool.Exec(ctx, "CREATE TABLE IF NOT EXISTS public.frm_test_shared (id int)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unqualified names resolve to the schema first and to public otherwise.
+	fsys := fstest.MapFS{
+		"0001_create_bookings.up.sql": {
+			Data: []byte("CREATE TABLE bookings (id int); CREATE VIEW shared AS SELECT id FROM frm_test_shared;"),
+		},
+	}
+
+	m, err := New(pool, fsys, WithSchema("frm_test_migrate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := postgres.CollectSingleValue[int64](ctx, pool,
+		"SELECT count(*) FROM pg_tables WHERE schemaname = 'frm_test_migrate' AND tablename = 'bookings'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Error("bookings not created in the schema")
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != 1 || status[0].AppliedAt.IsZero() {
+		t.Errorf("got status %+v, want one applied migration", status)
+	}
+}
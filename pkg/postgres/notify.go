@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNotifyOverflowTable = "notify_overflow"
+	// maxNotifyPayload is the largest payload NOTIFY accepts; payloads must be shorter than 8000 bytes.
+	maxNotifyPayload        = 7999
+	notifyOverflowRetention = "1 hour"
+	notifyOverflowTimeout   = 10 * time.Second
+	// notifyOverflowPrefix starts the reference sent instead of payloads exceeding the NOTIFY limit, followed by
+	// the ID of the stored payload. JSON never starts with it, so encoded values cannot be mistaken for references.
+	notifyOverflowPrefix = "#notify_overflow:"
+)
+
+// InitNotify creates the table for oversized notification payloads if it does not exist yet.
+func (p *Pool) InitNotify(ctx context.Context) error {
+	_, err := p.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id         bigserial   PRIMARY KEY,
+			payload    text        NOT NULL,
+			created_at timestamptz NOT NULL DEFAULT now()
+		)`, SanitizedIdentifier(p.notifyOverflowTable)))
+
+	return err
+}
+
+// Notify sends v as JSON to the channel. If the context carries a transaction (see ContextWithTx), the
+// notification is sent when it commits.
+//
+// Payloads exceeding the NOTIFY limit of 8000 bytes are stored in the overflow table (see InitNotify) and
+// a reference is sent instead, which HandleJSON resolves. Stored payloads are deleted after an hour.
+func (p *Pool) Notify(ctx context.Context, channel string, v any) error {
+	return p.NotifyWith(ctx, p, channel, v)
+}
+
+// NotifyWith is like Notify, but sends the notification using the given Execer. Pass a transaction to send
+// the notification when it commits.
+func (p *Pool) NotifyWith(ctx context.Context, e Execer, channel string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("notify %q: encode payload: %w", channel, err)
+	}
+
+	if len(payload) > maxNotifyPayload {
+		return p.notifyOverflow(ctx, e, channel, payload)
+	}
+
+	_, err = e.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(payload))
+	if err != nil {
+		return fmt.Errorf("notify %q: %w", channel, err)
+	}
+
+	return nil
+}
+
+// notifyOverflow stores the payload and sends a reference to it in a single statement.
+func (p *Pool) notifyOverflow(ctx context.Context, e Execer, channel string, payload []byte) error {
+	table := SanitizedIdentifier(p.notifyOverflowTable)
+
+	_, err := e.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE created_at < now() - interval '%s'`,
+		table, notifyOverflowRetention))
+	if err != nil {
+		return fmt.Errorf("notify %q: delete expired payloads: %w", channel, err)
+	}
+
+	_, err = e.Exec(ctx, fmt.Sprintf(`
+		WITH stored AS (INSERT INTO %s (payload) VALUES ($2) RETURNING id)
+		SELECT pg_notify($1, $3 || id) FROM stored`, table),
+		channel, string(payload), notifyOverflowPrefix,
+	)
+	if err != nil {
+		return fmt.Errorf("notify %q: store payload: %w", channel, err)
+	}
+
+	return nil
+}
+
+// HandleJSON subscribes the listener to the channel and calls fn with the payload decoded into T.
+// Payloads that cannot be decoded are reported as listener errors.
+func HandleJSON[T any](l *Listener, channel string, fn func(channel string, v T)) {
+	l.Subscribe(channel, func(channel string, payload string) {
+		data, err := l.resolvePayload(payload)
+		if err != nil {
+			l.reportError(fmt.Errorf("listener: %q: %w", channel, err))
+			return
+		}
+
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			l.reportError(fmt.Errorf("listener: %q: decode payload: %w", channel, err))
+			return
+		}
+
+		fn(channel, v)
+	})
+}
+
+// resolvePayload loads payloads stored in the overflow table by Notify.
+func (l *Listener) resolvePayload(payload string) ([]byte, error) {
+	ref, ok := strings.CutPrefix(payload, notifyOverflowPrefix)
+	if !ok {
+		return []byte(payload), nil
+	}
+
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("decode overflow reference: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyOverflowTimeout)
+	defer cancel()
+
+	stored, err := CollectSingleValue[string](ctx, l.pool,
+		fmt.Sprintf("SELECT payload FROM %s WHERE id = $1", SanitizedIdentifier(l.pool.notifyOverflowTable)),
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load overflow payload %d: %w", id, err)
+	}
+
+	return []byte(stored), nil
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// recordingExecer records the statements it executes.
+type recordingExecer struct {
+	statements []string
+	args       [][]any
+}
+
+func (e *recordingExecer) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	e.statements = append(e.statements, sql)
+	e.args = append(e.args, args)
+
+	return pgconn.CommandTag{}, nil
+}
+
+func TestNotifyPayloadLimit(t *testing.T) {
+	pool := &Pool{notifyOverflowTable: defaultNotifyOverflowTable}
+
+	tests := []struct {
+		size     int
+		overflow bool
+	}{
+		{maxNotifyPayload, false},
+		{maxNotifyPayload + 1, true},
+	}
+
+	for _, tt := range tests {
+		e := &recordingExecer{}
+
+		// A JSON string is encoded with its quotes.
+		value := strings.Repeat("a", tt.size-2)
+		if err := pool.NotifyWith(context.Background(), e, "assets", value); err != nil {
+			t.Fatal(err)
+		}
+
+		last := e.statements[len(e.statements)-1]
+		if overflow := strings.Contains(last, "INSERT INTO"); overflow != tt.overflow {
+			t.Errorf("got overflow %t for %d bytes, want %t", overflow, tt.size, tt.overflow)
+		}
+
+		if !tt.overflow && len(e.args[0][1].(string)) != tt.size {
+			t.Errorf("got payload of %d bytes, want %d", len(e.args[0][1].(string)), tt.size)
+		}
+	}
+}
+
+func TestResolvePayloadIgnoresLookalikes(t *testing.T) {
+	l := (&Pool{}).NewListener()
+
+	for _, payload := range []string{`{"$notify_overflow":1}`, `"#notify_overflow:1"`} {
+		data, err := l.resolvePayload(payload)
+		if err != nil || string(data) != payload {
+			t.Errorf("got %s, %v for %s, want it unchanged", data, err, payload)
+		}
+	}
+
+	if _, err := l.resolvePayload(notifyOverflowPrefix + "x"); err == nil {
+		t.Error("got no error for an invalid reference")
+	}
+}
+
+func TestNotifyOverflow(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t, WithNotifyOverflowTable("frm_test_notify_overflow"))
+
+	if err := pool.InitNotify(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), "DROP TABLE IF EXISTS frm_test_notify_overflow")
+	})
+
+	type message struct {
+		Text string `json:"text"`
+	}
+
+	received := make(chan string, 16)
+	l := pool.NewListener()
+	HandleJSON(l, "frm_test_notify", func(_ string, m message) { received <- m.Text })
+	runListener(t, l)
+
+	// Small messages are sent until the listener listens, then the oversized one follows.
+	deadline := time.After(listenTestTimeout)
+	for ready := false; !ready; {
+		if err := pool.Notify(ctx, "frm_test_notify", message{Text: "ping"}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-received:
+			ready = true
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("listener not ready")
+		}
+	}
+
+	large := strings.Repeat("a", 2*maxNotifyPayload)
+	if err := pool.Notify(ctx, "frm_test_notify", message{Text: large}); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		select {
+		case text := <-received:
+			if text == large {
+				return
+			}
+		case <-deadline:
+			t.Fatal("oversized payload not received")
+		}
+	}
+}
@@ -63,8 +63,31 @@ func WithOverrideRole(role string) Opt {
 	}
 }
 
+// WithAnonymousRole sets the role TxWithClaims uses for claims without a role. It should have no more privileges
+// than anonymous requests to the REST API.
+func WithAnonymousRole(role string) Opt {
+	return func(p *Pool) {
+		p.anonymousRole = role
+	}
+}
+
 func WithResetOnAcquire() Opt {
 	return func(p *Pool) {
 		p.resetOnAcquire = true
 	}
 }
+
+// WithTxHooks sets hooks called by RunInTx, e.g. to count retries.
+func WithTxHooks(h TxHooks) Opt {
+	return func(p *Pool) {
+		p.txHooks = h
+	}
+}
+
+// WithNotifyOverflowTable sets the table for notification payloads exceeding the NOTIFY limit.
+// Defaults to notify_overflow.
+func WithNotifyOverflowTable(table string) Opt {
+	return func(p *Pool) {
+		p.notifyOverflowTable = table
+	}
+}
@@ -36,17 +36,9 @@ func CollectOneRowToStruct[T any](ctx context.Context, q Querier, sql string, ar
 		return empty, wrapPgxError(err)
 	}
 
-	collected, err := pgx.CollectOneRow(rows, pgx.RowToStructByNameLax[T])
-	if err != nil {
-		var empty T
-		return empty, wrapPgxError(err)
-	}
-
-	if rows.CommandTag().RowsAffected() > 1 {
-		return collected, ErrTooManyRows
-	}
+	collected, err := collectOneRow(rows, pgx.RowToStructByNameLax[T])
 
-	return collected, nil
+	return collected, wrapPgxError(err)
 }
 
 func CollectColumn[T any](ctx context.Context, q Querier, sql string, args ...any) ([]T, error) {
@@ -70,10 +62,17 @@ func CollectSingleValue[T any](ctx context.Context, q Querier, sql string, args
 		return empty, wrapPgxError(err)
 	}
 
-	collected, err := pgx.CollectOneRow(rows, pgx.RowTo[T])
+	collected, err := collectOneRow(rows, pgx.RowTo[T])
+
+	return collected, wrapPgxError(err)
+}
+
+// collectOneRow collects the first row with fn and fails with ErrTooManyRows if there are more.
+func collectOneRow[T any](rows pgx.Rows, fn pgx.RowToFunc[T]) (T, error) {
+	collected, err := pgx.CollectOneRow(rows, fn)
 	if err != nil {
 		var empty T
-		return empty, wrapPgxError(err)
+		return empty, err
 	}
 
 	if rows.CommandTag().RowsAffected() > 1 {
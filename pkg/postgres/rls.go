@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/httputil"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// SettingJWTClaims holds the JWT claims as JSON, as set by PostgREST. RLS policies read it with
+	// current_setting('request.jwt.claims', true)::json.
+	SettingJWTClaims = "request.jwt.claims"
+	// SettingTenantID holds the tenant_id claim for policies that only need the tenant.
+	SettingTenantID = "request.tenant_id"
+)
+
+var ErrNoClaims = errors.New("no claims in context")
+
+// TxWithClaims runs fn in a transaction that enforces the RLS policies for the claims, like a request to the
+// REST API with the same token would. The claims and tenant settings and the role of the claims are applied
+// transaction-locally, so they never leak to other users of the connection.
+//
+// In the transaction carried by the context (see ContextWithTx), fn runs in a savepoint and the previous settings
+// and role are restored afterwards.
+//
+// Claims without a role run with the anonymous role of the pool (see WithAnonymousRole). Without one, they are
+// rejected with ErrEmptyRole, as the login role of the pool usually bypasses RLS.
+func (p *Pool) TxWithClaims(ctx context.Context, claims *httputil.ElionaJWT, fn func(tx pgx.Tx) error) error {
+	if claims == nil {
+		return ErrNoClaims
+	}
+
+	role := claims.Role
+	if role == "" {
+		role = p.anonymousRole
+	}
+
+	if role == "" {
+		return ErrEmptyRole
+	}
+
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return fmt.Errorf("encode claims: %w", err)
+	}
+
+	settings := []string{"role", SettingJWTClaims, SettingTenantID}
+
+	return p.inTxWithSettings(ctx, settings, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT set_config($1, $2, true), set_config($3, $4, true)",
+			SettingJWTClaims, string(encoded),
+			SettingTenantID, claims.TenantID,
+		)
+		if err != nil {
+			return wrapPgxError(err)
+		}
+
+		if err := setLocalRole(ctx, tx, role); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+// TxWithRequestClaims is like TxWithClaims, but takes the claims stored in the context by the httputil
+// authorization middleware. It returns ErrNoClaims if there are none.
+func (p *Pool) TxWithRequestClaims(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	claims, ok := httputil.ClaimsFromContext(ctx)
+	if !ok {
+		return ErrNoClaims
+	}
+
+	return p.TxWithClaims(ctx, claims, fn)
+}
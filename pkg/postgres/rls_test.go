@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/httputil"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestTxWithClaimsRejectsEmptyRole(t *testing.T) {
+	pool := &Pool{}
+	called := false
+
+	err := pool.TxWithClaims(context.Background(), &httputil.ElionaJWT{TenantID: "t1"}, func(pgx.Tx) error {
+		called = true
+		return nil
+	})
+
+	if !errors.Is(err, ErrEmptyRole) || called {
+		t.Errorf("got error %v and called %t, want %v without calling fn", err, called, ErrEmptyRole)
+	}
+
+	if err := pool.TxWithClaims(context.Background(), nil, nil); !errors.Is(err, ErrNoClaims) {
+		t.Errorf("got error %v, want %v", err, ErrNoClaims)
+	}
+}
+
+func TestTxWithClaims(t *testing.T) {
+	ctx := context.Background()
+	testRoles(t, "frm_test_anon", "frm_test_user")
+
+	pool := testPool(t, WithAnonymousRole("frm_test_anon"))
+
+	tests := []struct {
+		claims *httputil.ElionaJWT
+		want   string
+	}{
+		{&httputil.ElionaJWT{TenantID: "t1", Role: "frm_test_user"}, "frm_test_user"},
+		{&httputil.ElionaJWT{TenantID: "t1"}, "frm_test_anon"},
+	}
+
+	for _, tt := range tests {
+		err := pool.TxWithClaims(ctx, tt.claims, func(tx pgx.Tx) error {
+			var role, tenant string
+			err := tx.QueryRow(ctx, "SELECT current_user, current_setting($1)", SettingTenantID).Scan(&role, &tenant)
+			if err != nil {
+				return err
+			}
+
+			if role != tt.want || tenant != "t1" {
+				t.Errorf("got role %q and tenant %q, want %q and t1", role, tenant, tt.want)
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrEmptyRole = errors.New("empty role")
+
+// Conn is a connection pinned for the duration of a WithRole call. All statements run on the same connection.
+type Conn struct {
+	conn *pgxpool.Conn
+}
+
+func (c *Conn) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	ct, err := c.conn.Exec(ctx, query, args...)
+
+	return ct, wrapPgxError(err)
+}
+
+func (c *Conn) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	rows, err := c.conn.Query(ctx, query, args...)
+
+	return rows, wrapPgxError(err)
+}
+
+func (c *Conn) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return c.conn.QueryRow(ctx, query, args...)
+}
+
+// Begin starts a transaction on the connection. The role of the connection applies to the transaction.
+func (c *Conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := c.conn.Begin(ctx)
+
+	return tx, wrapPgxError(err)
+}
+
+// Conn returns the underlying pgx connection.
+func (c *Conn) Conn() *pgx.Conn {
+	return c.conn.Conn()
+}
+
+// WithRole runs fn on a connection with the given role. The role is reset when fn returns or panics;
+// if that fails, the connection is closed instead of being returned to the pool.
+// Rows queried in fn must be closed before fn returns.
+func (p *Pool) WithRole(ctx context.Context, role string, fn func(conn *Conn) error) error {
+	conn, err := p.acquireAs(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	defer p.resetRole(ctx, conn)
+
+	return fn(&Conn{conn: conn})
+}
+
+// TxAs runs fn in a transaction with the given role. The role is set with SET LOCAL and ends with the transaction.
+// The transaction is committed if fn returns nil and rolled back if it returns an error or panics. In the
+// transaction carried by the context (see ContextWithTx), fn runs in a savepoint and the previous role is restored.
+func (p *Pool) TxAs(ctx context.Context, role string, fn func(tx pgx.Tx) error) error {
+	if role == "" {
+		return ErrEmptyRole
+	}
+
+	return p.inTxWithSettings(ctx, []string{"role"}, func(tx pgx.Tx) error {
+		if err := setLocalRole(ctx, tx, role); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+func setLocalRole(ctx context.Context, tx pgx.Tx, role string) error {
+	_, err := tx.Exec(ctx, "SET LOCAL ROLE "+SanitizedIdentifier(role))
+
+	return wrapPgxError(err)
+}
+
+func (p *Pool) acquireAs(ctx context.Context, role string) (*pgxpool.Conn, error) {
+	if role == "" {
+		return nil, ErrEmptyRole
+	}
+
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, wrapPgxError(err)
+	}
+
+	if _, err := conn.Exec(ctx, "SET ROLE "+SanitizedIdentifier(role)); err != nil {
+		conn.Release()
+		return nil, wrapPgxError(err)
+	}
+
+	return conn, nil
+}
+
+// resetRole restores the role connections of the pool have (see WithOverrideRole) and releases the connection.
+// Connections that cannot be reset are closed, so no other caller gets a connection with the role.
+func (p *Pool) resetRole(ctx context.Context, conn *pgxpool.Conn) {
+	ctx = context.WithoutCancel(ctx)
+
+	if _, err := conn.Exec(ctx, p.setConnRoleSQL()); err != nil {
+		_ = conn.Conn().Close(ctx)
+	}
+
+	conn.Release()
+}
+
+// setConnRoleSQL returns the statement setting the role of new connections. RESET ROLE alone would return to
+// the login role instead of the override role.
+func (p *Pool) setConnRoleSQL() string {
+	if p.overrideRole == "" {
+		return "RESET ROLE"
+	}
+
+	return "SET ROLE " + SanitizedIdentifier(p.overrideRole)
+}
+
+// roleRows resets the role and releases the connection once the rows are closed or fully read.
+type roleRows struct {
+	pgx.Rows
+	ctx  context.Context
+	pool *Pool
+	conn *pgxpool.Conn
+	once sync.Once
+}
+
+func (r *roleRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.release()
+
+	return false
+}
+
+func (r *roleRows) Close() {
+	r.release()
+}
+
+func (r *roleRows) release() {
+	r.once.Do(func() {
+		r.Rows.Close()
+		r.pool.resetRole(r.ctx, r.conn)
+	})
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestSetConnRoleSQL(t *testing.T) {
+	if got := (&Pool{}).setConnRoleSQL(); got != "RESET ROLE" {
+		t.Errorf("got %q without override role, want RESET ROLE", got)
+	}
+
+	tests := []struct {
+		role string
+		want string
+	}{
+		{"app", `SET ROLE "app"`},
+		{`app"; DROP TABLE assets; --`, `SET ROLE "app""; DROP TABLE assets; --"`},
+	}
+
+	for _, tt := range tests {
+		if got := (&Pool{overrideRole: tt.role}).setConnRoleSQL(); got != tt.want {
+			t.Errorf("got %q with override role %q, want %q", got, tt.role, tt.want)
+		}
+	}
+}
+
+func TestWithRoleRestoresOverrideRole(t *testing.T) {
+	ctx := context.Background()
+	testRoles(t, "frm_test_app", "frm_test_user")
+
+	// A single connection makes sure the connection used by WithRole is reused afterwards.
+	pool := testPool(t, WithOverrideRole("frm_test_app"), WithMaxPoolSize(1))
+
+	err := pool.WithRole(ctx, "frm_test_user", func(conn *Conn) error {
+		var role string
+		if err := conn.QueryRow(ctx, "SELECT current_user").Scan(&role); err != nil {
+			return err
+		}
+
+		if role != "frm_test_user" {
+			t.Errorf("got role %q in WithRole, want frm_test_user", role)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRole(t, pool, "frm_test_app")
+
+	err = pool.TxAs(ctx, "frm_test_user", func(tx pgx.Tx) error {
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("got no error from TxAs")
+	}
+
+	assertRole(t, pool, "frm_test_app")
+
+	rows, err := pool.QueryAs(ctx, "frm_test_user", "SELECT current_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	assertRole(t, pool, "frm_test_app")
+}
+
+func TestWithRoleEmptyRole(t *testing.T) {
+	pool := &Pool{}
+
+	if err := pool.WithRole(context.Background(), "", func(*Conn) error { return nil }); !errors.Is(err, ErrEmptyRole) {
+		t.Errorf("got error %v, want %v", err, ErrEmptyRole)
+	}
+}
+
+func assertRole(t *testing.T, pool *Pool, want string) {
+	t.Helper()
+
+	role, err := CollectSingleValue[string](context.Background(), pool, "SELECT current_user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role != want {
+		t.Errorf("got role %q, want %q", role, want)
+	}
+}
@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultTxMaxRetries = 3
+	defaultTxMinBackoff = 10 * time.Millisecond
+	defaultTxMaxBackoff = 1 * time.Second
+
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// TxOptions configures RunInTx. The zero value runs a read-write transaction with the default isolation level
+// of the server and up to 3 retries.
+type TxOptions struct {
+	IsoLevel   pgx.TxIsoLevel
+	ReadOnly   bool
+	Deferrable bool
+
+	// MaxRetries is the number of retries after the first attempt. Defaults to 3, a negative value disables retries.
+	MaxRetries int
+	// MaxRetryDuration stops retrying once the time since the first attempt exceeds it. Zero means no limit.
+	MaxRetryDuration time.Duration
+	// MinBackoff and MaxBackoff bound the exponential backoff between attempts. Default to 10ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (o TxOptions) pgx() pgx.TxOptions {
+	opts := pgx.TxOptions{IsoLevel: o.IsoLevel}
+
+	if o.ReadOnly {
+		opts.AccessMode = pgx.ReadOnly
+	}
+
+	if o.Deferrable {
+		opts.DeferrableMode = pgx.Deferrable
+	}
+
+	return opts
+}
+
+// TxHooks receives events of RunInTx, e.g. to record metrics. All fields are optional.
+type TxHooks struct {
+	// OnRetry is called before an attempt is retried with the error that failed it.
+	OnRetry func(attempt int, err error)
+	// OnCommit is called after a transaction committed with the number of attempts and the total duration.
+	OnCommit func(attempts int, d time.Duration)
+	// OnFailure is called when RunInTx returns an error.
+	OnFailure func(attempts int, d time.Duration, err error)
+}
+
+// IsRetryable reports whether the error is a serialization failure (40001) or deadlock (40P01), which
+// succeed when the transaction is retried.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// RunInTx runs fn in a transaction that is committed if fn returns nil and rolled back if it returns an error
+// or panics. If fn or the commit fails with a serialization failure or deadlock, the whole function is retried
+// with backoff until the retry budget of opts is used up, so fn must not have side effects outside the transaction.
+//
+// The context passed to fn carries the transaction: Exec, Query and Tx of the pool use it, and a nested RunInTx,
+// TxAs or TxWithClaims runs in a savepoint that is rolled back if the inner fn fails and released otherwise.
+// Nested calls ignore opts and are not retried on their own; the error is returned so the outermost call retries
+// the whole transaction.
+func (p *Pool) RunInTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context, tx pgx.Tx) error) error {
+	run := func(tx pgx.Tx) error {
+		return fn(ContextWithTx(ctx, tx), tx)
+	}
+
+	if _, ok := TxFromContext(ctx); ok {
+		return p.inTx(ctx, opts.pgx(), run)
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultTxMaxRetries
+	}
+
+	backoff := opts.MinBackoff
+	if backoff <= 0 {
+		backoff = defaultTxMinBackoff
+	}
+
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultTxMaxBackoff
+	}
+
+	started := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		err := p.inTx(ctx, opts.pgx(), run)
+		if err == nil {
+			if p.txHooks.OnCommit != nil {
+				p.txHooks.OnCommit(attempt, time.Since(started))
+			}
+
+			return nil
+		}
+
+		if !IsRetryable(err) || attempt > maxRetries ||
+			(opts.MaxRetryDuration > 0 && time.Since(started) > opts.MaxRetryDuration) {
+			if p.txHooks.OnFailure != nil {
+				p.txHooks.OnFailure(attempt, time.Since(started), err)
+			}
+
+			return err
+		}
+
+		if p.txHooks.OnRetry != nil {
+			p.txHooks.OnRetry(attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if p.txHooks.OnFailure != nil {
+				p.txHooks.OnFailure(attempt, time.Since(started), ctx.Err())
+			}
+
+			return ctx.Err()
+		case <-time.After(retryDelay(backoff)):
+		}
+
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// retryDelay returns a random delay between 1ns and backoff. Full jitter keeps conflicting transactions from
+// retrying in lockstep.
+func retryDelay(backoff time.Duration) time.Duration {
+	return rand.N(backoff) + 1
+}
+
+// inTx runs fn in a single transaction that is committed if fn returns nil and rolled back otherwise. If the
+// context carries a transaction, fn runs in a savepoint of it instead and opts are ignored.
+func (p *Pool) inTx(ctx context.Context, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	var (
+		tx  pgx.Tx
+		err error
+	)
+
+	if outer, ok := TxFromContext(ctx); ok {
+		tx, err = outer.Begin(ctx)
+	} else {
+		tx, err = p.pool.BeginTx(ctx, opts)
+	}
+
+	if err != nil {
+		return wrapPgxError(err)
+	}
+
+	defer func() {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return wrapPgxError(tx.Commit(ctx))
+}
+
+// inTxWithSettings is like inTx for functions that change the given settings transaction-locally. Such changes
+// outlive the release of a savepoint, so in a savepoint the settings are restored before it is released.
+func (p *Pool) inTxWithSettings(ctx context.Context, settings []string, fn func(tx pgx.Tx) error) error {
+	if _, ok := TxFromContext(ctx); !ok {
+		return p.inTx(ctx, pgx.TxOptions{}, fn)
+	}
+
+	return p.inTx(ctx, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var values []*string
+		err := tx.QueryRow(ctx, `
+			SELECT array(
+				SELECT current_setting(s.name, true) FROM unnest($1::text[]) WITH ORDINALITY AS s(name, i) ORDER BY s.i
+			)`, settings,
+		).Scan(&values)
+		if err != nil {
+			return wrapPgxError(err)
+		}
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		// A NULL value resets settings that were not set before.
+		_, err = tx.Exec(ctx,
+			"SELECT set_config(s.name, s.value, true) FROM unnest($1::text[], $2::text[]) AS s(name, value)",
+			settings, values,
+		)
+
+		return wrapPgxError(err)
+	})
+}
+
+type txKey struct{}
+
+// ContextWithTx returns a context carrying the transaction. Pool methods called with the context run in it.
+// A transaction must only be used by one goroutine at a time.
+func ContextWithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by the context.
+func TxFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+
+	return tx, ok && tx != nil
+}
@@ -0,0 +1,248 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eliona-smart-building-assistant/backend-frm/pkg/httputil"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "40001"}, true},
+		{&pgconn.PgError{Code: "40P01"}, true},
+		{&QueryError{origin: &pgconn.PgError{Code: "40001"}, code: "40001"}, true},
+		{fmt.Errorf("commit: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{errors.New("40001"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("got %t for %v, want %t", got, tt.err, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, backoff := range []time.Duration{1, 10 * time.Millisecond, time.Second} {
+		for range 1000 {
+			if d := retryDelay(backoff); d < 1 || d > backoff {
+				t.Fatalf("got delay %v for backoff %v, want between 1ns and %v", d, backoff, backoff)
+			}
+		}
+	}
+}
+
+func TestRunInTxRetries(t *testing.T) {
+	tests := []struct {
+		code       string
+		failures   int
+		maxRetries int
+		want       []string
+	}{
+		{"40001", 2, 0, []string{"retry 1", "retry 2", "commit 3"}},
+		{"40P01", 1, 0, []string{"retry 1", "commit 2"}},
+		{"40001", 5, 1, []string{"retry 1", "failure 2"}},
+		{"23505", 1, 0, []string{"failure 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d failures", tt.code, tt.failures), func(t *testing.T) {
+			var events []string
+			pool := testPool(t, WithTxHooks(TxHooks{
+				OnRetry: func(attempt int, err error) {
+					events = append(events, fmt.Sprintf("retry %d", attempt))
+				},
+				OnCommit: func(attempts int, _ time.Duration) {
+					events = append(events, fmt.Sprintf("commit %d", attempts))
+				},
+				OnFailure: func(attempts int, _ time.Duration, _ error) {
+					events = append(events, fmt.Sprintf("failure %d", attempts))
+				},
+			}))
+
+			attempts := 0
+			opts := TxOptions{MaxRetries: tt.maxRetries, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+			err := pool.RunInTx(context.Background(), opts, func(ctx context.Context, tx pgx.Tx) error {
+				attempts++
+				if attempts > tt.failures {
+					return nil
+				}
+
+				_, err := tx.Exec(ctx, fmt.Sprintf("DO $$ BEGIN RAISE EXCEPTION 'conflict' USING ERRCODE = '%s'; END $$", tt.code))
+				return err
+			})
+
+			wantErr := strings.HasPrefix(tt.want[len(tt.want)-1], "failure")
+			if (err != nil) != wantErr {
+				t.Errorf("got error %v, want error %t", err, wantErr)
+			}
+
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("got events %v, want %v", events, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunInTxNested(t *testing.T) {
+	ctx := context.Background()
+	pool := testPool(t)
+
+	if _, err := pool.Exec(ctx, "CREATE TABLE IF NOT EXISTS frm_test_tx (id int)"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = pool.Exec(context.Background(), "DROP TABLE IF EXISTS frm_test_tx")
+	})
+
+	errInner := errors.New("inner")
+
+	err := pool.RunInTx(ctx, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := pool.Exec(ctx, "INSERT INTO frm_test_tx VALUES (1)"); err != nil {
+			return err
+		}
+
+		err := pool.RunInTx(ctx, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+			if _, err := pool.Exec(ctx, "INSERT INTO frm_test_tx VALUES (2)"); err != nil {
+				return err
+			}
+
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("got error %v from the failed savepoint, want %v", err, errInner)
+		}
+
+		return pool.RunInTx(ctx, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+			_, err := pool.Exec(ctx, "INSERT INTO frm_test_tx VALUES (3)")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := CollectColumn[int32](ctx, pool, "SELECT id FROM frm_test_tx ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ids, []int32{1, 3}) {
+		t.Errorf("got ids %v, want [1 3]", ids)
+	}
+}
+
+func TestTxAsInAmbientTx(t *testing.T) {
+	ctx := context.Background()
+	testRoles(t, "frm_test_user")
+
+	pool := testPool(t)
+
+	err := pool.RunInTx(ctx, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		var login string
+		if err := tx.QueryRow(ctx, "SELECT current_user").Scan(&login); err != nil {
+			return err
+		}
+
+		err := pool.TxAs(ctx, "frm_test_user", func(inner pgx.Tx) error {
+			assertTxRole(t, inner, "frm_test_user")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		assertTxRole(t, tx, login)
+
+		err = pool.TxAs(ctx, "frm_test_user", func(inner pgx.Tx) error {
+			_, err := inner.Exec(ctx, "SELECT 1/0")
+			return err
+		})
+		if err == nil {
+			t.Error("got no error from the failed TxAs")
+		}
+
+		// The failed savepoint was rolled back, so the outer transaction is still usable.
+		assertTxRole(t, tx, login)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxWithClaimsInAmbientTx(t *testing.T) {
+	ctx := context.Background()
+	testRoles(t, "frm_test_user")
+
+	pool := testPool(t)
+
+	err := pool.RunInTx(ctx, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		var login string
+		err := tx.QueryRow(ctx, "SELECT current_user, set_config($1, 'outer', true)", SettingTenantID).Scan(&login, nil)
+		if err != nil {
+			return err
+		}
+
+		claims := &httputil.ElionaJWT{TenantID: "t1", Role: "frm_test_user"}
+		err = pool.TxWithClaims(ctx, claims, func(inner pgx.Tx) error {
+			assertTxSetting(t, inner, SettingTenantID, "t1")
+			assertTxRole(t, inner, "frm_test_user")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		assertTxSetting(t, tx, SettingTenantID, "outer")
+		assertTxRole(t, tx, login)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertTxRole(t *testing.T, tx pgx.Tx, want string) {
+	t.Helper()
+
+	var role string
+	if err := tx.QueryRow(context.Background(), "SELECT current_user").Scan(&role); err != nil {
+		t.Fatal(err)
+	}
+
+	if role != want {
+		t.Errorf("got role %q, want %q", role, want)
+	}
+}
+
+func assertTxSetting(t *testing.T, tx pgx.Tx, name, want string) {
+	t.Helper()
+
+	var value string
+	if err := tx.QueryRow(context.Background(), "SELECT current_setting($1)", name).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+
+	if value != want {
+		t.Errorf("got %s %q, want %q", name, value, want)
+	}
+}